@@ -25,14 +25,28 @@ func Backend() *backend {
 		Help: backendHelp,
 		Paths: []*framework.Path{
 			// List more specific subkey routes first.
+			pathSubkeysRevoke(&b),
 			pathSubkeysRD(&b),
 			pathSubkeysCL(&b),
+			pathUIDs(&b),
+			pathUIDRevoke(&b),
+			pathUIDPrimary(&b),
+			pathRotate(&b),
+			pathExpiry(&b),
+			pathConfig(&b),
+			pathRevoke(&b),
 			pathKeys(&b),
 			pathListKeys(&b),
 			pathExportKeys(&b),
+			pathBackup(&b),
+			pathRestore(&b),
+			pathPublicKeys(&b),
+			pathListPublicKeys(&b),
 			pathSign(&b),
 			pathVerify(&b),
+			pathEncrypt(&b),
 			pathDecrypt(&b),
+			pathCertify(&b),
 			pathShowSessionKey(&b),
 		},
 		PathsSpecial: &logical.Paths{
@@ -298,6 +298,22 @@ func testAccStepReadKey(t *testing.T, b logical.Backend, storage logical.Storage
 
 func testAccStepDeleteKey(t *testing.T, b logical.Backend, storage logical.Storage, name string) {
 	response, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "keys/" + name + "/config",
+		Data: map[string]interface{}{
+			"deletion_allowed": true,
+		},
+		Storage: storage,
+	})
+
+	if err != nil {
+		t.Error(err)
+	}
+	if response.IsError() {
+		t.Error(response.Error())
+	}
+
+	response, err = b.HandleRequest(context.Background(), &logical.Request{
 		Operation: logical.DeleteOperation,
 		Path:      "keys/" + name,
 		Storage:   storage,
@@ -470,3 +486,39 @@ pij0lmiuqKqjtePx5gnMoyVXnDqgwsbxPh6GdKGx+Rgt47o1bXm/o8PSpA5Qbb3x
 VKmAi34bZfOYAeX554UB1xwK6a/T3rHf3eZM4Oc64dsmbhRftQ==
 =RtIM
 -----END PGP PRIVATE KEY BLOCK-----`
+
+// testHandleRequest handles a request with the backend and fails the test if
+// it returns an error. Error responses are returned to the caller.
+func testHandleRequest(t *testing.T, b logical.Backend, storage logical.Storage, operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	t.Helper()
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: operation,
+		Path:      path,
+		Data:      data,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// testRequest is like testHandleRequest, but also fails the test on error
+// responses.
+func testRequest(t *testing.T, b logical.Backend, storage logical.Storage, operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	t.Helper()
+	resp := testHandleRequest(t, b, storage, operation, path, data)
+	if resp != nil && resp.IsError() {
+		t.Fatalf("not expected error response: %#v", *resp)
+	}
+	return resp
+}
+
+// newTestRequest returns a function calling testRequest with the backend and
+// the storage.
+func newTestRequest(t *testing.T, b logical.Backend, storage logical.Storage) func(logical.Operation, string, map[string]interface{}) *logical.Response {
+	return func(operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		return testRequest(t, b, storage, operation, path, data)
+	}
+}
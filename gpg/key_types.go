@@ -0,0 +1,475 @@
+package gpg
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/ecdh"
+	"golang.org/x/crypto/openpgp/packet"
+	"golang.org/x/crypto/openpgp/s2k"
+	"golang.org/x/crypto/rsa"
+)
+
+// nistCurve describes a NIST curve usable for ECDSA signing keys and ECDH
+// encryption keys, along with the ECDH KDF parameters recommended for it by
+// RFC 6637, section 12. GnuPG rejects ECDSA signatures made with a hash
+// shorter than the curve, so hash is the smallest hash to sign with.
+type nistCurve struct {
+	curve     elliptic.Curve
+	hash      crypto.Hash
+	kdfHash   kdfHash
+	kdfCipher kdfCipher
+}
+
+var nistCurves = map[string]nistCurve{
+	"p256": {elliptic.P256(), crypto.SHA256, kdfHash{8, crypto.SHA256}, kdfCipher{7, 16}},
+	"p384": {elliptic.P384(), crypto.SHA384, kdfHash{9, crypto.SHA384}, kdfCipher{8, 24}},
+	"p521": {elliptic.P521(), crypto.SHA512, kdfHash{10, crypto.SHA512}, kdfCipher{9, 32}},
+}
+
+// curve25519Type is the curve type of ECDH keys on Curve25519, whose curve is
+// only a placeholder. The curve types are internal to the openpgp library.
+const curve25519Type = 2
+
+// cv25519KDF are the ECDH KDF parameters the openpgp library uses for
+// Curve25519 keys.
+var cv25519KDF = ecdh.KDF{Hash: kdfHash{10, crypto.SHA512}, Cipher: kdfCipher{9, 32}}
+
+// kdfHash and kdfCipher implement the hash and cipher interfaces of the ECDH
+// key derivation function, which are internal to the openpgp library.
+type kdfHash struct {
+	id uint8
+	crypto.Hash
+}
+
+func (h kdfHash) Id() uint8 {
+	return h.id
+}
+
+type kdfCipher struct {
+	id      uint8
+	keySize int
+}
+
+func (c kdfCipher) Id() uint8 {
+	return c.id
+}
+
+func (c kdfCipher) KeySize() int {
+	return c.keySize
+}
+
+func (c kdfCipher) BlockSize() int {
+	return aes.BlockSize
+}
+
+func (c kdfCipher) New(key []byte) cipher.Block {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	return block
+}
+
+// validKeyType checks that keyType is a key type that can be generated.
+func validKeyType(keyType string) error {
+	switch keyType {
+	case "rsa", "ed25519", "ecdsa-p256", "ecdsa-p384", "ecdsa-p521":
+		return nil
+	}
+	return fmt.Errorf("unsupported key type %s; must be \"rsa\", \"ed25519\", \"ecdsa-p256\", \"ecdsa-p384\" or \"ecdsa-p521\"", keyType)
+}
+
+// nistCurveForKeyType returns the NIST curve of an "ecdsa-*" key type.
+func nistCurveForKeyType(keyType string) (nistCurve, bool) {
+	if len(keyType) < len("ecdsa-") || keyType[:len("ecdsa-")] != "ecdsa-" {
+		return nistCurve{}, false
+	}
+	c, ok := nistCurves[keyType[len("ecdsa-"):]]
+	return c, ok
+}
+
+// newEntity generates an entity with a signing master key and an encryption
+// subkey of the given key type. RSA and Ed25519 keys are generated by the
+// openpgp library, which cannot generate keys on NIST curves.
+func newEntity(name, comment, email, keyType string, keyBits int, config *packet.Config) (*openpgp.Entity, error) {
+	switch keyType {
+	case "rsa":
+		config.Algorithm = packet.PubKeyAlgoRSA
+		config.RSABits = keyBits
+		return openpgp.NewEntity(name, comment, email, config)
+	case "ed25519":
+		config.Algorithm = packet.PubKeyAlgoEdDSA
+		return openpgp.NewEntity(name, comment, email, config)
+	}
+	c, ok := nistCurveForKeyType(keyType)
+	if !ok {
+		return nil, validKeyType(keyType)
+	}
+
+	uid := packet.NewUserId(name, comment, email)
+	if uid == nil {
+		return nil, fmt.Errorf("user id field contained invalid characters")
+	}
+
+	creationTime := config.Now()
+	keyLifetimeSecs := config.KeyLifetime()
+	signer, err := ecdsa.GenerateKey(c.curve, config.Random())
+	if err != nil {
+		return nil, err
+	}
+	primary := packet.NewSignerPrivateKey(creationTime, signer)
+
+	isPrimaryID := true
+	selfSignature := &packet.Signature{
+		Version:            primary.PublicKey.Version,
+		SigType:            packet.SigTypePositiveCert,
+		PubKeyAlgo:         primary.PublicKey.PubKeyAlgo,
+		Hash:               signatureHash(config.Hash(), &primary.PublicKey),
+		CreationTime:       creationTime,
+		KeyLifetimeSecs:    &keyLifetimeSecs,
+		IssuerKeyId:        &primary.PublicKey.KeyId,
+		IssuerFingerprint:  primary.PublicKey.Fingerprint,
+		IsPrimaryId:        &isPrimaryID,
+		FlagsValid:         true,
+		FlagSign:           true,
+		FlagCertify:        true,
+		MDC:                true,
+		PreferredSymmetric: []uint8{uint8(config.Cipher())},
+	}
+	// The hash of the curve is preferred, but other hashes are advertised so
+	// that the key can be a recipient along with keys preferring them.
+	for _, h := range []crypto.Hash{selfSignature.Hash, crypto.SHA512, crypto.SHA384, crypto.SHA256} {
+		hashID, ok := s2k.HashToHashId(h)
+		if !ok || bytes.IndexByte(selfSignature.PreferredHash, hashID) >= 0 {
+			continue
+		}
+		selfSignature.PreferredHash = append(selfSignature.PreferredHash, hashID)
+	}
+	err = selfSignature.SignUserId(uid.Id, &primary.PublicKey, primary, config)
+	if err != nil {
+		return nil, err
+	}
+
+	entity := &openpgp.Entity{
+		PrimaryKey: &primary.PublicKey,
+		PrivateKey: primary,
+		Identities: map[string]*openpgp.Identity{
+			uid.Id: {
+				Name:          uid.Id,
+				UserId:        uid,
+				SelfSignature: selfSignature,
+				Signatures:    []*packet.Signature{selfSignature},
+			},
+		},
+	}
+
+	// Like openpgp.NewEntity, the encryption subkey has no lifetime of its
+	// own and expires with the master key.
+	subkeyConfig := *config
+	subkeyConfig.KeyLifetimeSecs = 0
+	err = addSubkey(entity, keyType, keyBits, []string{"encrypt"}, &subkeyConfig)
+	if err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+// validCapabilities checks that a subkey of the given key type can be
+// generated with the given capabilities.
+func validCapabilities(keyType string, capabilities []string) error {
+	if len(capabilities) == 0 {
+		return fmt.Errorf("at least one capability is required")
+	}
+	seen := map[string]bool{}
+	for _, capability := range capabilities {
+		switch capability {
+		case "sign", "encrypt", "authenticate":
+		default:
+			return fmt.Errorf("unsupported capability %s; must be \"sign\", \"encrypt\" or \"authenticate\"", capability)
+		}
+		if seen[capability] {
+			return fmt.Errorf("duplicate capability %s", capability)
+		}
+		seen[capability] = true
+	}
+	if keyType != "rsa" && seen["encrypt"] && (seen["sign"] || seen["authenticate"]) {
+		return fmt.Errorf("%s subkeys cannot combine encryption with signing or authentication", keyType)
+	}
+	return nil
+}
+
+// newSubkeyPrivateKey generates the key material of a subkey. Encryption
+// subkeys of Ed25519 key types are Curve25519 ECDH keys, and those of NIST
+// curve key types are ECDH keys on the same curve.
+func newSubkeyPrivateKey(keyType string, keyBits int, encrypt bool, config *packet.Config) (*packet.PrivateKey, error) {
+	creationTime := config.Now()
+	switch keyType {
+	case "rsa":
+		priv, err := rsa.GenerateKey(config.Random(), keyBits)
+		if err != nil {
+			return nil, err
+		}
+		return packet.NewSignerPrivateKey(creationTime, priv), nil
+	case "ed25519":
+		if encrypt {
+			priv, err := ecdh.X25519GenerateKey(config.Random(), cv25519KDF)
+			if err != nil {
+				return nil, err
+			}
+			return packet.NewDecrypterPrivateKey(creationTime, priv), nil
+		}
+		_, priv, err := ed25519.GenerateKey(config.Random())
+		if err != nil {
+			return nil, err
+		}
+		return packet.NewSignerPrivateKey(creationTime, &priv), nil
+	}
+	c, ok := nistCurveForKeyType(keyType)
+	if !ok {
+		return nil, validKeyType(keyType)
+	}
+	if encrypt {
+		priv, err := ecdh.GenerateKey(c.curve, ecdh.KDF{Hash: c.kdfHash, Cipher: c.kdfCipher}, config.Random())
+		if err != nil {
+			return nil, err
+		}
+		return packet.NewDecrypterPrivateKey(creationTime, priv), nil
+	}
+	priv, err := ecdsa.GenerateKey(c.curve, config.Random())
+	if err != nil {
+		return nil, err
+	}
+	return packet.NewSignerPrivateKey(creationTime, priv), nil
+}
+
+// addSubkey generates a subkey of the given key type with the given
+// capabilities and binds it to the entity. RSA and Ed25519 subkeys with a
+// single capability are generated by the openpgp library.
+func addSubkey(e *openpgp.Entity, keyType string, keyBits int, capabilities []string, config *packet.Config) error {
+	var flags byte
+	for _, capability := range capabilities {
+		switch capability {
+		case "sign":
+			flags |= packet.KeyFlagSign
+		case "encrypt":
+			flags |= packet.KeyFlagEncryptCommunications | packet.KeyFlagEncryptStorage
+		case "authenticate":
+			flags |= keyFlagAuthenticate
+		}
+	}
+
+	if keyType == "rsa" || keyType == "ed25519" {
+		libraryConfig := *config
+		libraryConfig.DefaultHash = signatureHash(config.Hash(), e.PrimaryKey)
+		libraryConfig.Algorithm = packet.PubKeyAlgoEdDSA
+		if keyType == "rsa" {
+			libraryConfig.Algorithm = packet.PubKeyAlgoRSA
+			libraryConfig.RSABits = keyBits
+		}
+		switch flags {
+		case packet.KeyFlagSign:
+			return e.AddSigningSubkey(&libraryConfig)
+		case packet.KeyFlagEncryptCommunications | packet.KeyFlagEncryptStorage:
+			return e.AddEncryptionSubkey(&libraryConfig)
+		}
+	}
+
+	sub, err := newSubkeyPrivateKey(keyType, keyBits, flags&packet.KeyFlagEncryptCommunications != 0, config)
+	if err != nil {
+		return err
+	}
+	sub.IsSubkey = true
+	sub.PublicKey.IsSubkey = true
+
+	sig, err := bindSubkey(e, sub, flags, config.KeyLifetime(), config)
+	if err != nil {
+		return err
+	}
+
+	e.Subkeys = append(e.Subkeys, openpgp.Subkey{
+		PublicKey:  &sub.PublicKey,
+		PrivateKey: sub,
+		Sig:        sig,
+	})
+	return nil
+}
+
+// bindSubkey creates a binding signature of the subkey with the given key
+// flags and lifetime, in seconds from the creation time of the subkey. It
+// supersedes any previous binding signature.
+func bindSubkey(e *openpgp.Entity, sub *packet.PrivateKey, flags byte, keyLifetimeSecs uint32, config *packet.Config) (*packet.Signature, error) {
+	// Signing subkeys must cross-certify the master key, see RFC 4880,
+	// section 5.2.1.
+	var embedded *packet.Signature
+	if flags&packet.KeyFlagSign != 0 {
+		embedded = &packet.Signature{
+			Version:      sub.PublicKey.Version,
+			CreationTime: config.Now(),
+			SigType:      packet.SigTypePrimaryKeyBinding,
+			PubKeyAlgo:   sub.PublicKey.PubKeyAlgo,
+			Hash:         signatureHash(config.Hash(), &sub.PublicKey),
+			IssuerKeyId:  &sub.PublicKey.KeyId,
+		}
+		err := embedded.CrossSignKey(&sub.PublicKey, e.PrimaryKey, sub, config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	hash := signatureHash(config.Hash(), e.PrimaryKey)
+	if flags&^(packet.KeyFlagCertify|packet.KeyFlagSign|packet.KeyFlagEncryptCommunications|packet.KeyFlagEncryptStorage) != 0 {
+		return bindSubkeyWithSubpackets(e, sub, flags, keyLifetimeSecs, embedded, hash, config)
+	}
+
+	sig := &packet.Signature{
+		Version:                   e.PrimaryKey.Version,
+		CreationTime:              config.Now(),
+		SigType:                   packet.SigTypeSubkeyBinding,
+		PubKeyAlgo:                e.PrimaryKey.PubKeyAlgo,
+		Hash:                      hash,
+		FlagsValid:                true,
+		FlagCertify:               flags&packet.KeyFlagCertify != 0,
+		FlagSign:                  flags&packet.KeyFlagSign != 0,
+		FlagEncryptCommunications: flags&packet.KeyFlagEncryptCommunications != 0,
+		FlagEncryptStorage:        flags&packet.KeyFlagEncryptStorage != 0,
+		IssuerKeyId:               &e.PrimaryKey.KeyId,
+		EmbeddedSignature:         embedded,
+	}
+	if keyLifetimeSecs > 0 {
+		sig.KeyLifetimeSecs = &keyLifetimeSecs
+	}
+	if err := sig.SignKey(&sub.PublicKey, e.PrivateKey, config); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// bindSubkeyWithSubpackets creates a binding signature by hand, for key flags
+// that the openpgp library cannot set, such as the authentication flag.
+func bindSubkeyWithSubpackets(e *openpgp.Entity, sub *packet.PrivateKey, flags byte, keyLifetimeSecs uint32, embedded *packet.Signature, hash crypto.Hash, config *packet.Config) (*packet.Signature, error) {
+	issuerFingerprint, issuerKeyID := issuerSubpackets(e.PrimaryKey)
+	hashed := []subpacket{
+		creationTimeSubpacket(config.Now()),
+		issuerFingerprint,
+		{subpacketKeyFlags, []byte{flags}},
+	}
+	if keyLifetimeSecs > 0 {
+		lifetime := make([]byte, 4)
+		binary.BigEndian.PutUint32(lifetime, keyLifetimeSecs)
+		hashed = append(hashed, subpacket{subpacketKeyExpiration, lifetime})
+	}
+	if embedded != nil {
+		var buf bytes.Buffer
+		if err := embedded.Serialize(&buf); err != nil {
+			return nil, err
+		}
+		body, err := packetBody(buf.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		hashed = append(hashed, subpacket{subpacketEmbeddedSignature, body})
+	}
+
+	h := hash.New()
+	if err := e.PrimaryKey.SerializeForHash(h); err != nil {
+		return nil, err
+	}
+	if err := sub.PublicKey.SerializeForHash(h); err != nil {
+		return nil, err
+	}
+	return signWithSubpackets(h, packet.SigTypeSubkeyBinding, e.PrivateKey, hash, hashed, []subpacket{issuerKeyID}, config.Random())
+}
+
+// signatureHash returns h, or the smallest hash suitable for signing with
+// all of the given keys if h is too short.
+func signatureHash(h crypto.Hash, keys ...*packet.PublicKey) crypto.Hash {
+	for _, pk := range keys {
+		if pk.PubKeyAlgo != packet.PubKeyAlgoECDSA {
+			continue
+		}
+		if minimum := nistCurves[publicKeyCurve(pk)].hash; minimum != 0 && minimum.Size() > h.Size() {
+			h = minimum
+		}
+	}
+	return h
+}
+
+// publicKeyCurve returns the name of the curve of an elliptic curve public
+// key, or an empty string for other public keys.
+func publicKeyCurve(pk *packet.PublicKey) string {
+	var curve elliptic.Curve
+	switch key := pk.PublicKey.(type) {
+	case *ed25519.PublicKey:
+		return "ed25519"
+	case *ecdh.PublicKey:
+		if key.CurveType == curve25519Type {
+			return "cv25519"
+		}
+		curve = key.Curve
+	case *ecdsa.PublicKey:
+		curve = key.Curve
+	default:
+		return ""
+	}
+	for name, c := range nistCurves {
+		if curve != nil && curve.Params().Name == c.curve.Params().Name {
+			return name
+		}
+	}
+	return ""
+}
+
+// publicKeyType returns the key type of a public key, as reported by the
+// read endpoints.
+func publicKeyType(pk *packet.PublicKey) (string, error) {
+	curve := publicKeyCurve(pk)
+	switch {
+	case pk.PubKeyAlgo == packet.PubKeyAlgoRSA:
+		return "rsa", nil
+	case pk.PubKeyAlgo == packet.PubKeyAlgoEdDSA && curve == "ed25519":
+		return "ed25519", nil
+	case pk.PubKeyAlgo == packet.PubKeyAlgoECDH && curve == "cv25519":
+		return "cv25519", nil
+	case pk.PubKeyAlgo == packet.PubKeyAlgoECDSA && nistCurves[curve].curve != nil:
+		return "ecdsa-" + curve, nil
+	case pk.PubKeyAlgo == packet.PubKeyAlgoECDH && nistCurves[curve].curve != nil:
+		return "ecdh-" + curve, nil
+	}
+	return "", fmt.Errorf("unknown key type: %v", pk.PubKeyAlgo)
+}
+
+// keyTypeName returns the key type of a public key, or "unknown" for key types
+// that cannot be generated, such as DSA keys.
+func keyTypeName(pk *packet.PublicKey) string {
+	keyType, err := publicKeyType(pk)
+	if err != nil {
+		return "unknown"
+	}
+	return keyType
+}
+
+// publicKeyBits returns the size of a public key: the modulus length for RSA
+// keys and the curve size for elliptic curve keys.
+func publicKeyBits(pk *packet.PublicKey) (uint16, error) {
+	switch curve := publicKeyCurve(pk); curve {
+	case "":
+		return pk.BitLength()
+	case "cv25519", "ed25519":
+		return 255, nil
+	default:
+		c, ok := nistCurves[curve]
+		if !ok {
+			return 0, fmt.Errorf("unknown curve for key type: %v", pk.PubKeyAlgo)
+		}
+		return uint16(c.curve.Params().BitSize), nil
+	}
+}
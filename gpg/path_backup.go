@@ -0,0 +1,213 @@
+package gpg
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/openpgp"
+)
+
+func pathBackup(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "backup/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the key.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathBackupRead,
+			},
+		},
+		HelpSynopsis:    pathBackupHelpSyn,
+		HelpDescription: pathBackupHelpDesc,
+	}
+}
+
+func pathRestore(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "restore(/" + framework.GenericNameRegex("name") + ")?",
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the key to restore. If empty, the name of the backed up key is used.",
+			},
+			"backup": {
+				Type:        framework.TypeString,
+				Description: "The backup of the key, as returned by the backup endpoint.",
+			},
+			"force": {
+				Type:        framework.TypeBool,
+				Description: "Overwrites the key if it already exists. The existing key must allow deletion.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathRestoreWrite,
+			},
+		},
+		HelpSynopsis:    pathRestoreHelpSyn,
+		HelpDescription: pathRestoreHelpDesc,
+	}
+}
+
+var keyNameRegex = regexp.MustCompile("^" + framework.GenericNameRegex("name") + "$")
+
+// keyBackup is the content of a backup of a key.
+type keyBackup struct {
+	Name       string     `json:"name"`
+	Key        *keyEntry  `json:"key"`
+	BackupInfo backupInfo `json:"backup_info"`
+}
+
+type backupInfo struct {
+	Time    time.Time `json:"time"`
+	Version int       `json:"version"`
+}
+
+func (b *backend) pathBackupRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	entry, err := b.key(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return logical.ErrorResponse("master key does not exist"), nil
+	}
+	if !entry.AllowPlaintextBackup {
+		return logical.ErrorResponse("plaintext backup is not allowed for this key"), nil
+	}
+
+	backup, err := json.Marshal(&keyBackup{
+		Name: name,
+		Key:  entry,
+		BackupInfo: backupInfo{
+			Time:    time.Now().UTC(),
+			Version: entry.LatestVersion,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"backup": base64.StdEncoding.EncodeToString(backup),
+		},
+	}, nil
+}
+
+func (b *backend) pathRestoreWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	encoded := data.Get("backup").(string)
+	if encoded == "" {
+		return logical.ErrorResponse("backup is required"), nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return logical.ErrorResponse("unable to decode backup: %v", err), nil
+	}
+	var backup keyBackup
+	if err := json.Unmarshal(decoded, &backup); err != nil {
+		return logical.ErrorResponse("unable to decode backup: %v", err), nil
+	}
+	if err := validateBackup(&backup); err != nil {
+		return logical.ErrorResponse("invalid backup: %v", err), nil
+	}
+
+	name := data.Get("name").(string)
+	if name == "" {
+		name = backup.Name
+	}
+	if !keyNameRegex.MatchString(name) {
+		return logical.ErrorResponse("invalid key name %q", name), nil
+	}
+
+	lock := locksutil.LockForKey(b.keyLocks, name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	existing, err := b.key(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if !data.Get("force").(bool) {
+			return logical.ErrorResponse("master key %s already exists", name), nil
+		}
+		// Overwriting the key loses it just like deleting it
+		if !existing.DeletionAllowed {
+			return logical.ErrorResponse("deletion is not allowed for master key %s, so it cannot be overwritten", name), nil
+		}
+	}
+
+	if err := b.setKey(ctx, req.Storage, name, backup.Key); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// validateBackup checks that every version of the backed up key can be read.
+// Backups of keys stored before versioning was introduced are upgraded.
+func validateBackup(backup *keyBackup) error {
+	entry := backup.Key
+	if entry == nil {
+		return fmt.Errorf("missing key")
+	}
+	if entry.LatestVersion == 0 {
+		entry.LatestVersion = 1
+		entry.MinDecryptionVersion = 1
+	}
+	if entry.MinDecryptionVersion < 1 || entry.MinDecryptionVersion > entry.LatestVersion || entry.MinAvailableVersion > entry.MinDecryptionVersion {
+		return fmt.Errorf("inconsistent key versions")
+	}
+
+	versions := map[int][]byte{entry.LatestVersion: entry.SerializedKey}
+	for version, serializedKey := range entry.ArchivedKeys {
+		if version < 1 || version >= entry.LatestVersion {
+			return fmt.Errorf("unexpected archived version %d", version)
+		}
+		versions[version] = serializedKey
+	}
+	for version, serializedKey := range versions {
+		keyRing, err := openpgp.ReadKeyRing(bytes.NewReader(serializedKey))
+		if err != nil {
+			return fmt.Errorf("version %d: %v", version, err)
+		}
+		if len(keyRing) == 0 {
+			return fmt.Errorf("version %d: no key found", version)
+		}
+		for _, e := range keyRing {
+			if e.PrivateKey == nil {
+				return fmt.Errorf("version %d: key %s is not a private key", version, e.PrimaryKey.KeyIdString())
+			}
+		}
+		if version == entry.LatestVersion && (entry.DefaultEntity < 0 || entry.DefaultEntity >= len(keyRing)) {
+			return fmt.Errorf("default entity %d not found", entry.DefaultEntity)
+		}
+	}
+	return nil
+}
+
+const pathBackupHelpSyn = "Backup the named GPG key"
+const pathBackupHelpDesc = `
+This path is used to backup the named GPG key, including all its versions and
+its configuration. The key must allow plaintext backups, regardless of whether
+it is exportable. The backup can be restored with the restore endpoint.
+`
+
+const pathRestoreHelpSyn = "Restore a GPG key from a backup"
+const pathRestoreHelpDesc = `
+This path is used to restore a GPG key from a backup returned by the backup
+endpoint, possibly into another mount or cluster. The key is restored under
+its original name, unless another name is given.
+`
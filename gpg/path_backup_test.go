@@ -0,0 +1,168 @@
+package gpg
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestGPG_BackupRestore(t *testing.T) {
+	b := Backend()
+
+	storage := &logical.InmemStorage{}
+	testRequest(t, b, storage, logical.UpdateOperation, "keys/test", map[string]interface{}{
+		"real_name": "Vault GPG test",
+		"key_type":  "ed25519",
+	})
+	input := "QWxwYWNhcwo="
+	ciphertext := testRequest(t, b, storage, logical.UpdateOperation, "encrypt/test", map[string]interface{}{
+		"plaintext": input,
+	}).Data["ciphertext"]
+	testRequest(t, b, storage, logical.UpdateOperation, "keys/test/rotate", nil)
+	testRequest(t, b, storage, logical.UpdateOperation, "keys/test/config", map[string]interface{}{
+		"allow_plaintext_backup": true,
+	})
+	backup := testRequest(t, b, storage, logical.ReadOperation, "backup/test", nil).Data["backup"].(string)
+
+	checkRestored := func(storage logical.Storage, name string) {
+		resp := testRequest(t, b, storage, logical.ReadOperation, "keys/"+name+"/config", nil)
+		if resp.Data["latest_version"] != 2 || resp.Data["min_decryption_version"] != 1 || resp.Data["allow_plaintext_backup"] != true {
+			t.Fatalf("unexpected configuration of restored key: %#v", resp.Data)
+		}
+		resp = testRequest(t, b, storage, logical.UpdateOperation, "decrypt/"+name, map[string]interface{}{
+			"ciphertext": ciphertext,
+		})
+		if resp.Data["plaintext"] != input {
+			t.Fatalf("unexpected plaintext: %v", resp.Data["plaintext"])
+		}
+		signature := testRequest(t, b, storage, logical.UpdateOperation, "sign/"+name, map[string]interface{}{
+			"input": input,
+		}).Data["signature"]
+		resp = testRequest(t, b, storage, logical.UpdateOperation, "verify/"+name, map[string]interface{}{
+			"input":     input,
+			"signature": signature,
+		})
+		if resp.Data["valid"] != true {
+			t.Fatalf("expected signature to be valid: %v", resp.Data["error"])
+		}
+	}
+
+	// Restore into another mount, under the original name and another one
+	other := &logical.InmemStorage{}
+	testRequest(t, b, other, logical.UpdateOperation, "restore", map[string]interface{}{
+		"backup": backup,
+	})
+	checkRestored(other, "test")
+	testRequest(t, b, other, logical.UpdateOperation, "restore/copy", map[string]interface{}{
+		"backup": backup,
+	})
+	checkRestored(other, "copy")
+
+	// Existing keys are only overwritten when forced, and if they can be deleted
+	for _, force := range []bool{false, true} {
+		resp, _ := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      "restore/test",
+			Data: map[string]interface{}{
+				"backup": backup,
+				"force":  force,
+			},
+		})
+		if !resp.IsError() {
+			t.Fatalf("expected restore of an existing key to fail, force: %v", force)
+		}
+	}
+	testRequest(t, b, storage, logical.UpdateOperation, "keys/test/config", map[string]interface{}{
+		"deletion_allowed": true,
+	})
+	testRequest(t, b, storage, logical.UpdateOperation, "restore/test", map[string]interface{}{
+		"backup": backup,
+		"force":  true,
+	})
+	checkRestored(storage, "test")
+}
+
+func TestGPG_BackupRestoreError(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/test",
+		Data: map[string]interface{}{
+			"real_name":  "Vault GPG test",
+			"key_type":   "ed25519",
+			"exportable": true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requestMustFail := func(operation logical.Operation, path string, data map[string]interface{}) {
+		resp, _ := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: operation,
+			Path:      path,
+			Data:      data,
+		})
+		if !resp.IsError() {
+			t.Fatalf("expected to fail, path: %s, data: %v", path, data)
+		}
+	}
+
+	// Exportable keys cannot be backed up without allowing plaintext backups
+	requestMustFail(logical.ReadOperation, "backup/test", nil)
+	requestMustFail(logical.ReadOperation, "backup/doNotExist", nil)
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/test/config",
+		Data: map[string]interface{}{
+			"allow_plaintext_backup": true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	requestMustFail(logical.UpdateOperation, "keys/test/config", map[string]interface{}{"allow_plaintext_backup": false})
+
+	encode := func(backup string) string {
+		return base64.StdEncoding.EncodeToString([]byte(backup))
+	}
+	requestMustFail(logical.UpdateOperation, "restore/other", map[string]interface{}{})
+	requestMustFail(logical.UpdateOperation, "restore/other", map[string]interface{}{"backup": "Not base64"})
+	requestMustFail(logical.UpdateOperation, "restore/other", map[string]interface{}{"backup": encode("Not JSON")})
+	requestMustFail(logical.UpdateOperation, "restore/other", map[string]interface{}{"backup": encode(`{"name":"other"}`)})
+	requestMustFail(logical.UpdateOperation, "restore/other", map[string]interface{}{"backup": encode(`{"name":"other","key":{"SerializedKey":"bm90IGEga2V5"}}`)})
+
+	// The name of the backed up key must be valid
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.ReadOperation,
+		Path:      "backup/test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(resp.Data["backup"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var backup map[string]interface{}
+	if err := json.Unmarshal(decoded, &backup); err != nil {
+		t.Fatal(err)
+	}
+	backup["name"] = "../other"
+	encoded, err := json.Marshal(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requestMustFail(logical.UpdateOperation, "restore", map[string]interface{}{"backup": encode(string(encoded))})
+}
@@ -0,0 +1,227 @@
+package gpg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func pathCertify(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "certify/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "The key to use",
+			},
+			"public_key": {
+				Type:        framework.TypeString,
+				Description: "The ASCII-armored public key to certify",
+			},
+			"uid": {
+				Type:        framework.TypeString,
+				Description: "The user ID of the public key to certify. If empty, all the user IDs that are not revoked are certified.",
+			},
+			"certification_level": {
+				Type:        framework.TypeInt,
+				Default:     0,
+				Description: "The certification level. Can be 0 (no indication), 1 (no verification), 2 (casual verification) or 3 (extensive verification). Defaults to 0.",
+			},
+			"expires": {
+				Type:        framework.TypeInt,
+				Default:     0,
+				Description: "The number of seconds from the creation time (now) after which the certification expires. If the number is zero, then the certification never expires.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathCertifyWrite,
+			},
+		},
+		HelpSynopsis:    pathCertifyHelpSyn,
+		HelpDescription: pathCertifyHelpDesc,
+	}
+}
+
+// certificationTypes maps the certification levels to signature types, see
+// RFC 4880, section 5.2.1.
+var certificationTypes = []packet.SignatureType{
+	packet.SigTypeGenericCert,
+	packet.SigTypePersonaCert,
+	packet.SigTypeCasualCert,
+	packet.SigTypePositiveCert,
+}
+
+func (b *backend) pathCertifyWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	level := data.Get("certification_level").(int)
+	if level < 0 || level >= len(certificationTypes) {
+		return logical.ErrorResponse("unsupported certification level %d; must be 0, 1, 2 or 3", level), nil
+	}
+	expires := data.Get("expires").(int)
+	if expires < 0 {
+		return logical.ErrorResponse("expires cannot be negative"), nil
+	}
+
+	signer, _, err := b.readEntity(ctx, req.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if signer == nil {
+		return logical.ErrorResponse("master key does not exist"), nil
+	}
+	if len(signer.Revocations) > 0 {
+		return logical.ErrorResponse("master key is revoked"), nil
+	}
+	config := &packet.Config{}
+	if signer.PrimaryKey.KeyExpired(signer.PrimaryIdentity().SelfSignature, config.Now()) {
+		return logical.ErrorResponse("master key has expired"), nil
+	}
+
+	block, err := armor.Decode(strings.NewReader(data.Get("public_key").(string)))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	serializedKey, err := ioutil.ReadAll(block.Body)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	el, err := openpgp.ReadKeyRing(bytes.NewReader(serializedKey))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	if len(el) != 1 {
+		return logical.ErrorResponse("expected 1 public key, got %d", len(el)), logical.ErrInvalidRequest
+	}
+	entity := el[0]
+
+	var uids []string
+	if uid := data.Get("uid").(string); uid != "" {
+		identity, ok := entity.Identities[uid]
+		if !ok {
+			return logical.ErrorResponse("user ID %s does not exist", uid), nil
+		}
+		if identityRevocation(entity, identity) != nil {
+			return logical.ErrorResponse("user ID %s is revoked", uid), nil
+		}
+		uids = append(uids, uid)
+	} else {
+		for uid, identity := range entity.Identities {
+			if identityRevocation(entity, identity) == nil {
+				uids = append(uids, uid)
+			}
+		}
+		sort.Strings(uids)
+	}
+
+	if len(uids) == 0 {
+		return logical.ErrorResponse("no user ID to certify"), nil
+	}
+
+	certifications := make(map[string]*packet.Signature)
+	for _, uid := range uids {
+		sig := &packet.Signature{
+			Version:      signer.PrimaryKey.Version,
+			CreationTime: config.Now(),
+			SigType:      certificationTypes[level],
+			PubKeyAlgo:   signer.PrimaryKey.PubKeyAlgo,
+			Hash:         signatureHash(config.Hash(), signer.PrimaryKey),
+			IssuerKeyId:  &signer.PrimaryKey.KeyId,
+		}
+		if expires > 0 {
+			lifetime := uint32(expires)
+			sig.SigLifetimeSecs = &lifetime
+		}
+		if err := sig.SignUserId(uid, entity.PrimaryKey, signer.PrivateKey, config); err != nil {
+			return nil, err
+		}
+		certifications[uid] = sig
+	}
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := appendCertifications(w, serializedKey, certifications); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"public_key": buf.String(),
+		},
+	}, nil
+}
+
+// userIDPacketTag is the packet tag of user IDs, see RFC 4880, section 4.3.
+const userIDPacketTag = 13
+
+// appendCertifications writes the serialized public key with the given
+// certifications appended to the signatures of their user ID. The other
+// packets, such as user attributes and direct key signatures, are copied as
+// is, except for secret keys which are written as public keys.
+func appendCertifications(w io.Writer, serializedKey []byte, certifications map[string]*packet.Signature) error {
+	var pending *packet.Signature
+	for rest := serializedKey; len(rest) > 0; {
+		tag, raw, body, next, err := nextPacket(rest)
+		if err != nil {
+			return err
+		}
+		rest = next
+
+		// The certification follows the existing signatures of its user ID
+		if tag != signaturePacketTag && pending != nil {
+			if err := pending.Serialize(w); err != nil {
+				return err
+			}
+			pending = nil
+		}
+		if tag == userIDPacketTag {
+			pending = certifications[string(body)]
+		}
+
+		if tag == secretKeyPacketTag || tag == secretSubkeyPacketTag {
+			p, err := packet.Read(bytes.NewReader(raw))
+			if err != nil {
+				return err
+			}
+			pk, ok := p.(*packet.PrivateKey)
+			if !ok {
+				return fmt.Errorf("unable to parse private key")
+			}
+			if err := pk.PublicKey.Serialize(w); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := w.Write(raw); err != nil {
+			return err
+		}
+	}
+	if pending != nil {
+		return pending.Serialize(w)
+	}
+	return nil
+}
+
+const pathCertifyHelpSyn = "Certify the user IDs of a public key using a named GPG key"
+
+const pathCertifyHelpDesc = `
+This path uses the named GPG key from the request path to certify one or all
+the user IDs of a user provided public key. The public key is returned
+ASCII-armored, with the new certifications appended to the signatures of
+their user IDs and its other packets unchanged.
+`
@@ -0,0 +1,249 @@
+package gpg
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func TestGPG_Certify(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/ca",
+		Data: map[string]interface{}{
+			"real_name": "Vault GPG CA",
+			"key_type":  "ed25519",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.ReadOperation,
+		Path:      "keys/ca",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	el, err := openpgp.ReadArmoredKeyRing(strings.NewReader(resp.Data["public_key"].(string)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := el[0]
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "certify/ca",
+		Data: map[string]interface{}{
+			"public_key":          gpgPublicKey,
+			"certification_level": 3,
+			"expires":             3600,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.IsError() {
+		t.Fatalf("not expected error response: %#v", *resp)
+	}
+
+	el, err = openpgp.ReadArmoredKeyRing(strings.NewReader(resp.Data["public_key"].(string)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if el[0].PrivateKey != nil {
+		t.Fatal("private key should not be returned")
+	}
+	for uid, identity := range el[0].Identities {
+		var certification *packet.Signature
+		for _, sig := range identity.Signatures {
+			if sig.IssuerKeyId != nil && *sig.IssuerKeyId == ca.PrimaryKey.KeyId {
+				certification = sig
+			}
+		}
+		if certification == nil {
+			t.Fatalf("no certification found for user ID %s", uid)
+		}
+		if certification.SigType != packet.SigTypePositiveCert {
+			t.Errorf("expected positive certification, got %v", certification.SigType)
+		}
+		if certification.SigLifetimeSecs == nil || *certification.SigLifetimeSecs != 3600 {
+			t.Errorf("expected certification to expire after 3600 seconds")
+		}
+		if err := ca.PrimaryKey.VerifyUserIdSignature(uid, el[0].PrimaryKey, certification); err != nil {
+			t.Errorf("invalid certification of user ID %s: %v", uid, err)
+		}
+	}
+}
+
+func TestGPG_CertifyError(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/ca",
+		Data: map[string]interface{}{
+			"real_name": "Vault GPG CA",
+			"key_type":  "ed25519",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certifyMustFail := func(keyName, publicKey, uid string, level int) {
+		resp, _ := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      "certify/" + keyName,
+			Data: map[string]interface{}{
+				"public_key":          publicKey,
+				"uid":                 uid,
+				"certification_level": level,
+			},
+		})
+		if !resp.IsError() {
+			t.Fatalf("expected to fail, keyname: %s, uid: %s, level: %d", keyName, uid, level)
+		}
+	}
+
+	certifyMustFail("doNotExist", gpgPublicKey, "", 0)
+	certifyMustFail("ca", "Not ASCII armored", "", 0)
+	certifyMustFail("ca", gpgPublicKey, "Unknown", 0)
+	certifyMustFail("ca", gpgPublicKey, "", 4)
+}
+
+func TestGPG_CertifyKeepsPackets(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/ca",
+		Data: map[string]interface{}{
+			"real_name": "Vault GPG CA",
+			"key_type":  "ed25519",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The public key has a direct key signature and a user attribute, which
+	// the openpgp library drops
+	entity, err := openpgp.NewEntity("Vault GPG test", "", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	direct := &packet.Signature{
+		Version:      entity.PrimaryKey.Version,
+		CreationTime: time.Now(),
+		SigType:      packet.SigTypeDirectSignature,
+		PubKeyAlgo:   entity.PrimaryKey.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		IssuerKeyId:  &entity.PrimaryKey.KeyId,
+	}
+	h := direct.Hash.New()
+	if err := entity.PrimaryKey.SerializeForHash(h); err != nil {
+		t.Fatal(err)
+	}
+	if err := direct.Sign(h, entity.PrivateKey, nil); err != nil {
+		t.Fatal(err)
+	}
+	var directPacket, attributePacket, serialized bytes.Buffer
+	if err := direct.Serialize(&directPacket); err != nil {
+		t.Fatal(err)
+	}
+	attribute := packet.NewUserAttribute(&packet.OpaqueSubpacket{SubType: 100, Contents: []byte("Vault")})
+	if err := attribute.Serialize(&attributePacket); err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(&serialized); err != nil {
+		t.Fatal(err)
+	}
+	splitPackets := func(p []byte) [][]byte {
+		var packets [][]byte
+		for len(p) > 0 {
+			_, raw, _, rest, err := nextPacket(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			packets = append(packets, raw)
+			p = rest
+		}
+		return packets
+	}
+	// The master key, user ID, self-signature, subkey and binding signature
+	packets := splitPackets(serialized.Bytes())
+	if len(packets) != 5 {
+		t.Fatalf("expected 5 packets, got %d", len(packets))
+	}
+	input := bytes.Join([][]byte{packets[0], directPacket.Bytes(), packets[1], packets[2], attributePacket.Bytes(), packets[3], packets[4]}, nil)
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(input); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "certify/ca",
+		Data: map[string]interface{}{
+			"public_key": buf.String(),
+		},
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("unable to certify: %v %#v", err, resp)
+	}
+
+	// The certification follows the self-signature, and the other packets
+	// are kept as they are
+	block, err := armor.Decode(strings.NewReader(resp.Data["public_key"].(string)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	certified, err := ioutil.ReadAll(block.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := splitPackets(certified)
+	if len(output) != 8 {
+		t.Fatalf("expected 8 packets, got %d", len(output))
+	}
+	p, err := packet.Read(bytes.NewReader(output[4]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig, ok := p.(*packet.Signature); !ok || sig.SigType != packet.SigTypeGenericCert {
+		t.Fatalf("expected a certification after the self-signature, got %#v", p)
+	}
+	if !bytes.Equal(bytes.Join(append(output[:4:4], output[5:]...), nil), input) {
+		t.Fatal("expected the other packets to be kept")
+	}
+}
@@ -0,0 +1,179 @@
+package gpg
+
+import (
+	"context"
+	"encoding/hex"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/config",
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the key.",
+			},
+			"min_decryption_version": {
+				Type:        framework.TypeInt,
+				Description: "The minimum version of the key that can be used to decrypt and verify data.",
+			},
+			"min_available_version": {
+				Type:        framework.TypeInt,
+				Description: "The minimum version of the key to keep in storage. Older versions are permanently deleted. Cannot be greater than min_decryption_version nor decreased.",
+			},
+			"allow_plaintext_backup": {
+				Type:        framework.TypeBool,
+				Description: "Enables the key to be backed up, regardless of whether it is exportable. Once enabled, it cannot be disabled.",
+			},
+			"deletion_allowed": {
+				Type:        framework.TypeBool,
+				Description: "Allows the key to be deleted.",
+			},
+			"exportable": {
+				Type:        framework.TypeBool,
+				Description: "Enables the key to be exportable. Once enabled, it cannot be disabled.",
+			},
+			"default_key": {
+				Type:        framework.TypeString,
+				Description: "The key ID or fingerprint of the key of the keyring used to sign and encrypt data.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathConfigRead,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathConfigWrite,
+			},
+		},
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+func (b *backend) pathConfigRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	entry, err := b.key(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return logical.ErrorResponse("master key does not exist"), nil
+	}
+	entity, err := b.entity(entry)
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil {
+		return logical.ErrorResponse("master key does not exist"), nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"latest_version":         entry.LatestVersion,
+			"min_decryption_version": entry.MinDecryptionVersion,
+			"min_available_version":  entry.MinAvailableVersion,
+			"allow_plaintext_backup": entry.AllowPlaintextBackup,
+			"deletion_allowed":       entry.DeletionAllowed,
+			"exportable":             entry.Exportable,
+			"default_key":            hex.EncodeToString(entity.PrimaryKey.Fingerprint[:]),
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	lock := locksutil.LockForKey(b.keyLocks, name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	entry, err := b.key(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return logical.ErrorResponse("master key does not exist"), nil
+	}
+
+	minDecryptionVersion := entry.MinDecryptionVersion
+	if v, ok := data.GetOk("min_decryption_version"); ok {
+		minDecryptionVersion = v.(int)
+	}
+	minAvailableVersion := entry.MinAvailableVersion
+	if v, ok := data.GetOk("min_available_version"); ok {
+		minAvailableVersion = v.(int)
+	}
+
+	allowPlaintextBackup := entry.AllowPlaintextBackup
+	if v, ok := data.GetOk("allow_plaintext_backup"); ok {
+		allowPlaintextBackup = v.(bool)
+	}
+	deletionAllowed := entry.DeletionAllowed
+	if v, ok := data.GetOk("deletion_allowed"); ok {
+		deletionAllowed = v.(bool)
+	}
+	exportable := entry.Exportable
+	if v, ok := data.GetOk("exportable"); ok {
+		exportable = v.(bool)
+	}
+
+	defaultEntity := entry.DefaultEntity
+	if v, ok := data.GetOk("default_key"); ok {
+		keyRing, err := b.keyRing(entry)
+		if err != nil {
+			return nil, err
+		}
+		if defaultEntity, ok = findEntity(keyRing, v.(string)); !ok {
+			return logical.ErrorResponse("default key %s not found in the keyring", v.(string)), nil
+		}
+		entry.setKeyTimes(keyRing[defaultEntity])
+	}
+
+	switch {
+	case entry.AllowPlaintextBackup && !allowPlaintextBackup:
+		return logical.ErrorResponse("allow_plaintext_backup cannot be disabled once enabled"), nil
+	case entry.Exportable && !exportable:
+		return logical.ErrorResponse("exportable cannot be disabled once enabled"), nil
+	case minDecryptionVersion < 1:
+		return logical.ErrorResponse("min_decryption_version must be at least 1"), nil
+	case minDecryptionVersion > entry.LatestVersion:
+		return logical.ErrorResponse("min_decryption_version cannot be greater than the latest version %d", entry.LatestVersion), nil
+	case minAvailableVersion < entry.MinAvailableVersion:
+		return logical.ErrorResponse("min_available_version cannot be decreased, versions older than %d have been deleted", entry.MinAvailableVersion), nil
+	case minAvailableVersion > minDecryptionVersion:
+		return logical.ErrorResponse("min_available_version cannot be greater than min_decryption_version"), nil
+	}
+
+	entry.MinDecryptionVersion = minDecryptionVersion
+	entry.MinAvailableVersion = minAvailableVersion
+	entry.AllowPlaintextBackup = allowPlaintextBackup
+	entry.DeletionAllowed = deletionAllowed
+	entry.Exportable = exportable
+	entry.DefaultEntity = defaultEntity
+	for version := range entry.ArchivedKeys {
+		if version < minAvailableVersion {
+			delete(entry.ArchivedKeys, version)
+		}
+	}
+
+	if err := b.setKey(ctx, req.Storage, name, entry); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+const pathConfigHelpSyn = "Configure a named GPG key"
+const pathConfigHelpDesc = `
+This path is used to configure the named GPG key. The minimum decryption
+version restricts the versions of the key that can be used to decrypt and
+verify data. The minimum available version deletes the older versions from
+storage. Allowing plaintext backups enables the key to be backed up.
+Keys can only be deleted once deletion is allowed, and exportable and plaintext
+backups cannot be disabled once enabled. The default key selects the key of a
+keyring used to sign and encrypt data.
+`
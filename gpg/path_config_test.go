@@ -0,0 +1,57 @@
+package gpg
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestGPG_KeyConfigDeletionAndExport(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	request := newTestRequest(t, b, storage)
+
+	request(logical.UpdateOperation, "keys/test", map[string]interface{}{
+		"real_name": "Vault GPG test",
+		"key_type":  "ed25519",
+	})
+	resp := request(logical.ReadOperation, "keys/test/config", nil)
+	if resp.Data["deletion_allowed"] != false || resp.Data["exportable"] != false {
+		t.Fatalf("unexpected default configuration: %#v", resp.Data)
+	}
+
+	// Keys cannot be deleted by default
+	if resp = testHandleRequest(t, b, storage, logical.DeleteOperation, "keys/test", nil); !resp.IsError() {
+		t.Fatal("expected deletion to be refused")
+	}
+	request(logical.ReadOperation, "keys/test", nil)
+
+	// Keys can be made exportable, but not the other way around
+	if resp = testHandleRequest(t, b, storage, logical.ReadOperation, "export/test", nil); !resp.IsError() {
+		t.Fatal("expected export to be refused")
+	}
+	request(logical.UpdateOperation, "keys/test/config", map[string]interface{}{"exportable": true})
+	request(logical.ReadOperation, "export/test", nil)
+	if resp = testHandleRequest(t, b, storage, logical.UpdateOperation, "keys/test/config", map[string]interface{}{"exportable": false}); !resp.IsError() {
+		t.Fatal("expected exportable to be one-way")
+	}
+
+	// Deletion can be allowed and disallowed again
+	for _, allowed := range []bool{true, false} {
+		request(logical.UpdateOperation, "keys/test/config", map[string]interface{}{"deletion_allowed": allowed})
+		resp = request(logical.ReadOperation, "keys/test/config", nil)
+		if resp.Data["deletion_allowed"] != allowed || resp.Data["exportable"] != true {
+			t.Fatalf("unexpected configuration: %#v", resp.Data)
+		}
+	}
+	if resp = testHandleRequest(t, b, storage, logical.DeleteOperation, "keys/test", nil); !resp.IsError() {
+		t.Fatal("expected deletion to be refused")
+	}
+
+	request(logical.UpdateOperation, "keys/test/config", map[string]interface{}{"deletion_allowed": true})
+	request(logical.DeleteOperation, "keys/test", nil)
+	if resp = testHandleRequest(t, b, storage, logical.ReadOperation, "keys/test", nil); !resp.IsError() {
+		t.Fatal("expected key to be deleted")
+	}
+}
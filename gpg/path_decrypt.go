@@ -4,13 +4,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 	"golang.org/x/crypto/openpgp"
 	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
 	"io"
+	"io/ioutil"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func pathDecrypt(b *backend) *framework.Path {
@@ -34,6 +39,14 @@ func pathDecrypt(b *backend) *framework.Path {
 				Type:        framework.TypeString,
 				Description: "The ASCII-armored GPG key of the signer of the ciphertext. If present, the signature must be valid.",
 			},
+			"signer_public_keys": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "The names of the stored public keys of the possible signers of the ciphertext. If present, the signature must be valid.",
+			},
+			"session_key": {
+				Type:        framework.TypeString,
+				Description: `The session key of the ciphertext, in the "algo:HEX" format returned by show-session-key. If present, the ciphertext is decrypted with it instead of the named key.`,
+			},
 		},
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.UpdateOperation: &framework.PathOperation{
@@ -62,8 +75,7 @@ func (b *backend) pathDecryptWrite(ctx context.Context, req *logical.Request, da
 		return logical.ErrorResponse("key not found"), logical.ErrInvalidRequest
 	}
 
-	r := bytes.NewReader(keyEntry.SerializedKey)
-	keyring, err := openpgp.ReadKeyRing(r)
+	keyring, err := b.decryptionKeyRing(keyEntry)
 	if err != nil {
 		return nil, err
 	}
@@ -76,6 +88,12 @@ func (b *backend) pathDecryptWrite(ctx context.Context, req *logical.Request, da
 		}
 		keyring = append(keyring, el[0])
 	}
+	signerPublicKeys := data.Get("signer_public_keys").([]string)
+	publicKeys, resp, err := b.publicKeyRing(ctx, req.Storage, signerPublicKeys)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+	keyring = append(keyring, publicKeys...)
 
 	ciphertextEncoded := strings.NewReader(data.Get("ciphertext").(string))
 	var ciphertextDecoder io.Reader
@@ -90,7 +108,28 @@ func (b *backend) pathDecryptWrite(ctx context.Context, req *logical.Request, da
 		ciphertextDecoder = block.Body
 	}
 
-	md, err := openpgp.ReadMessage(ciphertextDecoder, keyring, nil, nil)
+	ciphertext, err := ioutil.ReadAll(ciphertextDecoder)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	var md *openpgp.MessageDetails
+	var decrypted io.ReadCloser
+	var cipherFunc packet.CipherFunction
+	if sessionKey := data.Get("session_key").(string); sessionKey != "" {
+		var key []byte
+		cipherFunc, key, err = parseSessionKey(sessionKey)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+		decrypted, err = decryptData(ciphertext, cipherFunc, key)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+		// The decrypted data is read as an unencrypted message
+		md, err = openpgp.ReadMessage(decrypted, keyring, nil, nil)
+	} else {
+		md, err = openpgp.ReadMessage(bytes.NewReader(ciphertext), keyring, nil, nil)
+	}
 	if err != nil {
 		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
 	}
@@ -103,21 +142,147 @@ func (b *backend) pathDecryptWrite(ctx context.Context, req *logical.Request, da
 	if err = w.Close(); err != nil {
 		return nil, err
 	}
+	// Closing the decrypted data checks its integrity
+	if decrypted != nil {
+		if err = decrypted.Close(); err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+	}
 
-	if signerKey != "" && (!md.IsSigned || md.SignedBy == nil || md.SignatureError != nil) {
+	if (signerKey != "" || len(signerPublicKeys) > 0) && (!md.IsSigned || md.SignedBy == nil || md.SignatureError != nil) {
 		return logical.ErrorResponse("Signature is invalid or not present"), nil
 	}
 
+	recipientKeyID, cipher := "", ""
+	switch {
+	case decrypted != nil:
+		cipher = cipherName(cipherFunc)
+	case md.IsEncrypted:
+		recipientKeyID = md.DecryptedWith.PublicKey.KeyIdString()
+		cipherFunc, err = sessionCipher(ciphertext, md.DecryptedWith)
+		if err != nil {
+			return nil, err
+		}
+		cipher = cipherName(cipherFunc)
+	}
+	signedByKeyID := ""
+	if md.IsSigned {
+		signedByKeyID = fmt.Sprintf("%016X", md.SignedByKeyId)
+	}
+	modificationTime := time.Time{}
+	if md.LiteralData.Time != 0 {
+		modificationTime = time.Unix(int64(md.LiteralData.Time), 0)
+	}
+
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"plaintext": plaintext.String(),
+			"plaintext":         plaintext.String(),
+			"filename":          md.LiteralData.FileName,
+			"modification_time": formatTime(modificationTime),
+			"is_binary":         md.LiteralData.IsBinary,
+			"is_signed":         md.IsSigned,
+			"signed_by_key_id":  signedByKeyID,
+			"signature_valid":   md.IsSigned && md.SignedBy != nil && md.SignatureError == nil,
+			"recipient_key_id":  recipientKeyID,
+			"cipher":            cipher,
 		},
 	}, nil
 }
 
+// sessionCipher returns the symmetric cipher of a message, by decrypting again
+// the session key with the key which decrypted the message, as the openpgp
+// library does not report it.
+func sessionCipher(ciphertext []byte, key openpgp.Key) (packet.CipherFunction, error) {
+	packets := packet.NewReader(bytes.NewReader(ciphertext))
+	for {
+		p, err := packets.Next()
+		if err != nil {
+			return 0, err
+		}
+		encryptedKey, ok := p.(*packet.EncryptedKey)
+		if !ok {
+			break
+		}
+		if encryptedKey.KeyId != 0 && encryptedKey.KeyId != key.PublicKey.KeyId {
+			continue
+		}
+		if err := encryptedKey.Decrypt(key.PrivateKey, nil); err == nil {
+			return encryptedKey.CipherFunc, nil
+		}
+	}
+	return 0, fmt.Errorf("no session key encrypted to %s", key.PublicKey.KeyIdString())
+}
+
+// parseSessionKey parses a session key in the "algo:HEX" format, where algo is
+// the OpenPGP identifier of the symmetric cipher.
+func parseSessionKey(sessionKey string) (packet.CipherFunction, []byte, error) {
+	parts := strings.SplitN(sessionKey, ":", 2)
+	if len(parts) != 2 {
+		return 0, nil, fmt.Errorf("session key must be in the algo:HEX format")
+	}
+	algo, err := strconv.ParseUint(parts[0], 10, 8)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid cipher algorithm %s", parts[0])
+	}
+	cipherFunc := packet.CipherFunction(algo)
+	if cipherFunc.KeySize() == 0 {
+		return 0, nil, fmt.Errorf("unsupported cipher algorithm %d", algo)
+	}
+	key, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return 0, nil, fmt.Errorf("unable to decode session key as hex: %s", err)
+	}
+	if len(key) != cipherFunc.KeySize() {
+		return 0, nil, fmt.Errorf("session key must be %d bytes long for cipher algorithm %d", cipherFunc.KeySize(), algo)
+	}
+	return cipherFunc, key, nil
+}
+
+// decryptData returns the decrypted contents of the encrypted data packet of a
+// message, skipping the encrypted session keys which precede it.
+func decryptData(ciphertext []byte, cipherFunc packet.CipherFunction, key []byte) (io.ReadCloser, error) {
+	packets := packet.NewReader(bytes.NewReader(ciphertext))
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no encrypted data found")
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch p := p.(type) {
+		case *packet.EncryptedKey, *packet.SymmetricKeyEncrypted:
+		case packet.EncryptedDataPacket:
+			return p.Decrypt(cipherFunc, key)
+		default:
+			return nil, fmt.Errorf("no encrypted data found")
+		}
+	}
+}
+
+// cipherName returns the name of a symmetric cipher.
+func cipherName(c packet.CipherFunction) string {
+	switch c {
+	case packet.Cipher3DES:
+		return "3des"
+	case packet.CipherCAST5:
+		return "cast5"
+	case packet.CipherAES128:
+		return "aes128"
+	case packet.CipherAES192:
+		return "aes192"
+	case packet.CipherAES256:
+		return "aes256"
+	}
+	return fmt.Sprintf("unknown (%d)", c)
+}
+
 const pathDecryptHelpSyn = "Decrypt a ciphertext value using a named GPG key"
 
 const pathDecryptHelpDesc = `
 This path uses the named GPG key from the request path to decrypt a user
-provided ciphertext. The plaintext is returned base64 encoded.
+provided ciphertext. The plaintext is returned base64 encoded, along with the
+metadata of the literal data, the signer of the message and the key and cipher
+used to decrypt it. The ciphertext can also be decrypted with its session key,
+as returned by show-session-key, instead of the named key.
 `
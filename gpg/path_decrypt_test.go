@@ -1,10 +1,17 @@
 package gpg
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
 )
 
 func TestGPG_Decrypt(t *testing.T) {
@@ -266,3 +273,181 @@ Ubm5BjtILbgkwpbSWBghW+lx5POhVt9mFax+Su9fZkUrPj3UGnHH2jeFB4EwHtkI
 TSpU+MkEN1+Gdp+peD7lHSgfOxvpfJt4qA8ic89DSWF1YYK8a8CkiiqnMQ==
 =Bepf
 -----END PGP MESSAGE-----`
+
+func TestGPG_DecryptDetails(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	request := newTestRequest(t, b, storage)
+
+	request(logical.UpdateOperation, "keys/test", map[string]interface{}{
+		"real_name": "Vault GPG test",
+		"key_type":  "ed25519",
+	})
+	entity, _, err := b.readEntity(context.Background(), storage, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptionKey, ok := entity.EncryptionKey(time.Now())
+	if !ok {
+		t.Fatal("no encryption key")
+	}
+	// Let the message be encrypted with another cipher than the default one
+	for _, identity := range entity.Identities {
+		identity.SelfSignature.PreferredSymmetric = []uint8{uint8(packet.CipherAES256)}
+	}
+	vendor, err := newEntity("Vendor", "", "", "ed25519", 0, &packet.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vendorKey bytes.Buffer
+	w, err := armor.Encode(&vendorKey, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vendor.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	modificationTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	encrypt := func(signed *openpgp.Entity, hints *openpgp.FileHints) string {
+		var ciphertext bytes.Buffer
+		w, err := openpgp.Encrypt(&ciphertext, []*openpgp.Entity{entity}, signed, hints, &packet.Config{
+			DefaultCipher: packet.CipherAES256,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte("Alpacas\n")); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(ciphertext.Bytes())
+	}
+	signed := encrypt(vendor, &openpgp.FileHints{FileName: "alpacas.txt", ModTime: modificationTime})
+	unsigned := encrypt(nil, &openpgp.FileHints{IsBinary: true})
+
+	for _, test := range []struct {
+		ciphertext string
+		signerKey  string
+		expected   map[string]interface{}
+	}{
+		{signed, vendorKey.String(), map[string]interface{}{
+			"filename":          "alpacas.txt",
+			"modification_time": formatTime(modificationTime),
+			"is_binary":         false,
+			"is_signed":         true,
+			"signed_by_key_id":  vendor.PrimaryKey.KeyIdString(),
+			"signature_valid":   true,
+		}},
+		// Without the key of the signer, the signature cannot be checked
+		{signed, "", map[string]interface{}{
+			"is_signed":        true,
+			"signed_by_key_id": vendor.PrimaryKey.KeyIdString(),
+			"signature_valid":  false,
+		}},
+		{unsigned, "", map[string]interface{}{
+			"filename":          "",
+			"modification_time": "",
+			"is_binary":         true,
+			"is_signed":         false,
+			"signed_by_key_id":  "",
+			"signature_valid":   false,
+		}},
+	} {
+		resp := request(logical.UpdateOperation, "decrypt/test", map[string]interface{}{
+			"ciphertext": test.ciphertext,
+			"signer_key": test.signerKey,
+		})
+		test.expected["plaintext"] = "QWxwYWNhcwo="
+		test.expected["recipient_key_id"] = encryptionKey.PublicKey.KeyIdString()
+		test.expected["cipher"] = "aes256"
+		for k, v := range test.expected {
+			if resp.Data[k] != v {
+				t.Errorf("expected %s to be %v, got %v", k, v, resp.Data[k])
+			}
+		}
+	}
+}
+
+func TestGPG_DecryptSessionKey(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	request := newTestRequest(t, b, storage)
+
+	for _, name := range []string{"test", "escrow"} {
+		request(logical.UpdateOperation, "keys/"+name, map[string]interface{}{
+			"real_name": "Vault GPG test",
+			"key_type":  "ed25519",
+		})
+	}
+	plaintext := "QWxwYWNhcwo="
+	ciphertext := request(logical.UpdateOperation, "encrypt/test", map[string]interface{}{
+		"plaintext": plaintext,
+		"sign":      true,
+	}).Data["ciphertext"]
+	sessionKey := request(logical.UpdateOperation, "show-session-key/test", map[string]interface{}{
+		"ciphertext": ciphertext,
+	}).Data["session_key"].(string)
+	entity, _, err := b.readEntity(context.Background(), storage, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signerKey bytes.Buffer
+	w, err := armor.Encode(&signerKey, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The session key decrypts the message without the key of a recipient
+	resp := request(logical.UpdateOperation, "decrypt/escrow", map[string]interface{}{
+		"ciphertext":  ciphertext,
+		"session_key": sessionKey,
+		"signer_key":  signerKey.String(),
+	})
+	if resp.Data["plaintext"] != plaintext || resp.Data["cipher"] != "aes128" || resp.Data["recipient_key_id"] != "" || resp.Data["signature_valid"] != true {
+		t.Fatalf("unexpected decryption with the session key: %v", resp.Data)
+	}
+	resp = request(logical.UpdateOperation, "decrypt/escrow", map[string]interface{}{
+		"ciphertext":  encryptedSessionMessageBase64Encoded,
+		"session_key": "9:EC211D19FA4FFC7F88B6AC6A1112C88032910753AB52FEF10C71D850A721151C",
+	})
+	if resp.Data["plaintext"] != plaintext || resp.Data["cipher"] != "aes256" {
+		t.Fatalf("unexpected decryption with the session key: %v", resp.Data)
+	}
+
+	for _, sessionKey := range []string{
+		"7:" + strings.Repeat("00", 16),
+		"9:EC211D19FA4FFC7F88B6AC6A1112C88032910753AB52FEF10C71D850A721151C",
+		"7",
+		"aes128:" + sessionKey[2:],
+		"42:" + sessionKey[2:],
+		"7:not hex",
+		"9:" + sessionKey[2:],
+	} {
+		resp, _ := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      "decrypt/escrow",
+			Data: map[string]interface{}{
+				"ciphertext":  ciphertext,
+				"session_key": sessionKey,
+			},
+		})
+		if !resp.IsError() {
+			t.Errorf("expected decryption with session key %s to fail", sessionKey)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package gpg
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+	"golang.org/x/crypto/openpgp/s2k"
+)
+
+func pathEncrypt(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "encrypt/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "The key to use",
+			},
+			"plaintext": {
+				Type:        framework.TypeString,
+				Description: "The base64-encoded plaintext to encrypt",
+			},
+			"format": {
+				Type:        framework.TypeString,
+				Default:     "base64",
+				Description: `Encoding format to use. Can be "base64" or "ascii-armor". Defaults to "base64".`,
+			},
+			"recipient_keys": {
+				Type:        framework.TypeStringSlice,
+				Description: "The ASCII-armored GPG public keys of additional recipients of the ciphertext.",
+			},
+			"recipient_public_keys": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "The names of the stored public keys of additional recipients of the ciphertext.",
+			},
+			"sign": {
+				Type:        framework.TypeBool,
+				Default:     false,
+				Description: "Whether to also sign the plaintext with the named key, inside the encrypted message.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathEncryptWrite,
+			},
+		},
+		HelpSynopsis:    pathEncryptHelpSyn,
+		HelpDescription: pathEncryptHelpDesc,
+	}
+}
+
+func (b *backend) pathEncryptWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	format := data.Get("format").(string)
+	switch format {
+	case "base64":
+	case "ascii-armor":
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("unsupported encoding format %s; must be \"base64\" or \"ascii-armor\"", format)), nil
+	}
+
+	entity, _, err := b.readEntity(ctx, req.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil {
+		return logical.ErrorResponse("master key does not exist"), nil
+	}
+	if len(entity.Revocations) > 0 {
+		return logical.ErrorResponse("master key is revoked"), nil
+	}
+
+	recipients := []*openpgp.Entity{entity}
+	for _, recipientKey := range data.Get("recipient_keys").([]string) {
+		el, err := openpgp.ReadArmoredKeyRing(strings.NewReader(recipientKey))
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+		recipients = append(recipients, el...)
+	}
+	publicKeys, resp, err := b.publicKeyRing(ctx, req.Storage, data.Get("recipient_public_keys").([]string))
+	if resp != nil || err != nil {
+		return resp, err
+	}
+	for _, e := range publicKeys {
+		if len(e.Revocations) > 0 {
+			return logical.ErrorResponse("public key %s is revoked", e.PrimaryKey.KeyIdString()), nil
+		}
+	}
+	recipients = append(recipients, publicKeys...)
+
+	input, err := base64.StdEncoding.DecodeString(data.Get("plaintext").(string))
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("unable to decode plaintext as base64: %s", err)), logical.ErrInvalidRequest
+	}
+
+	var signed *openpgp.Entity
+	config := packet.Config{}
+	if data.Get("sign").(bool) {
+		signingKey, ok := entity.SigningKey(config.Now())
+		if !ok {
+			return logical.ErrorResponse("master key has no valid signing key"), nil
+		}
+		signed = entity
+		// ECDSA keys on larger curves need a hash at least as long as the
+		// curve, which the recipients must accept since the openpgp library
+		// otherwise silently signs with a hash they share.
+		if minimum := signatureHash(config.Hash(), signingKey.PublicKey); minimum != config.Hash() {
+			config.DefaultHash = 0
+			for _, h := range sharedHashes(recipients) {
+				if h.Size() >= minimum.Size() {
+					config.DefaultHash = h
+					break
+				}
+			}
+			if config.DefaultHash == 0 {
+				return logical.ErrorResponse("the recipients do not accept a hash strong enough for the signing key"), nil
+			}
+		}
+	}
+
+	var ciphertext bytes.Buffer
+	var ciphertextEncoder io.WriteCloser
+	switch format {
+	case "base64":
+		ciphertextEncoder = base64.NewEncoder(base64.StdEncoding, &ciphertext)
+	case "ascii-armor":
+		ciphertextEncoder, err = armor.Encode(&ciphertext, messageType, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	w, err := openpgp.Encrypt(ciphertextEncoder, recipients, signed, &openpgp.FileHints{IsBinary: true}, &config)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if _, err = w.Write(input); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	if err = ciphertextEncoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"ciphertext": ciphertext.String(),
+		},
+	}, nil
+}
+
+// sharedHashes returns the hashes preferred by all the recipients, in the
+// order in which the openpgp library picks the hash of the signature of a
+// signed and encrypted message. Recipients without preferences are assumed to
+// only accept SHA-256, like the openpgp library does.
+func sharedHashes(recipients []*openpgp.Entity) []crypto.Hash {
+	hashes := []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512, crypto.SHA1, crypto.RIPEMD160}
+	for _, e := range recipients {
+		preferred := []uint8{}
+		if identity := e.PrimaryIdentity(); identity != nil {
+			preferred = identity.SelfSignature.PreferredHash
+		}
+		if len(preferred) == 0 {
+			hashID, _ := s2k.HashToHashId(crypto.SHA256)
+			preferred = []uint8{hashID}
+		}
+		var shared []crypto.Hash
+		for _, h := range hashes {
+			if hashID, ok := s2k.HashToHashId(h); ok && bytes.IndexByte(preferred, hashID) >= 0 {
+				shared = append(shared, h)
+			}
+		}
+		hashes = shared
+	}
+	return hashes
+}
+
+// messageType is the armor type for an OpenPGP message.
+const messageType = "PGP MESSAGE"
+
+const pathEncryptHelpSyn = "Encrypt a plaintext value using a named GPG key"
+
+const pathEncryptHelpDesc = `
+This path uses the named GPG key from the request path to encrypt a user
+provided plaintext. Additional recipients can be given as ASCII-armored
+public keys, or as the names of stored public keys. The plaintext can also be
+signed with the named key in the same message. The plaintext must be base64
+encoded.
+`
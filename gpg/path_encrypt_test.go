@@ -0,0 +1,274 @@
+package gpg
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/base64"
+	"io/ioutil"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/openpgp"
+)
+
+func TestGPG_EncryptDecrypt(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	req := &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/test",
+		Data: map[string]interface{}{
+			"real_name": "Vault GPG test",
+		},
+	}
+	_, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req = &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/other",
+		Data: map[string]interface{}{
+			"generate": false,
+			"key":      gpgKey,
+			"expires":  0,
+		},
+	}
+	_, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypt := func(keyName, plaintext, format string, recipientKeys []string) string {
+		reqEncrypt := &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      "encrypt/" + keyName,
+			Data: map[string]interface{}{
+				"plaintext":      plaintext,
+				"format":         format,
+				"recipient_keys": recipientKeys,
+			},
+		}
+
+		resp, err := b.HandleRequest(context.Background(), reqEncrypt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.IsError() {
+			t.Fatalf("not expected error response: %#v", *resp)
+		}
+		ciphertext, ok := resp.Data["ciphertext"]
+		if !ok {
+			t.Fatalf("no ciphertext key found in response data %#v", resp.Data)
+		}
+		return ciphertext.(string)
+	}
+
+	decrypt := func(keyName, ciphertext, format, expected string) {
+		reqDecrypt := &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      "decrypt/" + keyName,
+			Data: map[string]interface{}{
+				"ciphertext": ciphertext,
+				"format":     format,
+			},
+		}
+
+		resp, err := b.HandleRequest(context.Background(), reqDecrypt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.IsError() {
+			t.Fatalf("not expected error response: %#v", *resp)
+		}
+		plaintext, ok := resp.Data["plaintext"]
+		if !ok {
+			t.Fatalf("no plaintext key found in response data %#v", resp.Data)
+		}
+		if plaintext != expected {
+			t.Fatalf("expected plaintext %s, got: %s", expected, plaintext)
+		}
+	}
+
+	plaintext := "QWxwYWNhcwo="
+	decrypt("test", encrypt("test", plaintext, "base64", nil), "base64", plaintext)
+	decrypt("test", encrypt("test", plaintext, "ascii-armor", nil), "ascii-armor", plaintext)
+
+	// Additional recipients can decrypt too
+	ciphertext := encrypt("test", plaintext, "base64", []string{gpgPublicKey})
+	decrypt("test", ciphertext, "base64", plaintext)
+	decrypt("other", ciphertext, "base64", plaintext)
+}
+
+func TestGPG_EncryptError(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	req := &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/test",
+		Data: map[string]interface{}{
+			"real_name": "Vault GPG test",
+		},
+	}
+	_, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encryptMustFail := func(keyName, plaintext, format string, recipientKeys []string) {
+		reqEncrypt := &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      "encrypt/" + keyName,
+			Data: map[string]interface{}{
+				"plaintext":      plaintext,
+				"format":         format,
+				"recipient_keys": recipientKeys,
+			},
+		}
+
+		resp, _ := b.HandleRequest(context.Background(), reqEncrypt)
+		if !resp.IsError() {
+			t.Fatalf(
+				"expected to fail, keyname: %s, format: %s, plaintext: %s, recipient keys: %v",
+				keyName, format, plaintext, recipientKeys)
+		}
+	}
+
+	encryptMustFail("doNotExist", "QWxwYWNhcwo=", "base64", nil)
+	encryptMustFail("test", "QWxwYWNhcwo=", "invalidFormat", nil)
+
+	// Not base64 encoded
+	encryptMustFail("test", "Not base64 encoded", "base64", nil)
+
+	// Recipient key is not properly ASCII-armored
+	encryptMustFail("test", "QWxwYWNhcwo=", "base64", []string{"Recipient key is not ASCII armored"})
+}
+
+func TestGPG_EncryptSigned(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	request := newTestRequest(t, b, storage)
+
+	request(logical.UpdateOperation, "keys/other", map[string]interface{}{
+		"generate": false,
+		"key":      gpgKey,
+		"expires":  0,
+	})
+	plaintext := "QWxwYWNhcwo="
+	for _, keyType := range []string{"rsa", "ed25519", "ecdsa-p521"} {
+		request(logical.UpdateOperation, "keys/"+keyType, map[string]interface{}{
+			"real_name": "Vault GPG test",
+			"key_type":  keyType,
+			"key_bits":  2048,
+		})
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: logical.ReadOperation,
+			Path:      "keys/" + keyType,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		signerKey := resp.Data["public_key"]
+
+		for _, format := range []string{"base64", "ascii-armor"} {
+			signed := request(logical.UpdateOperation, "encrypt/"+keyType, map[string]interface{}{
+				"plaintext":      plaintext,
+				"format":         format,
+				"recipient_keys": []string{gpgPublicKey},
+				"sign":           true,
+			}).Data["ciphertext"]
+			unsigned := request(logical.UpdateOperation, "encrypt/"+keyType, map[string]interface{}{
+				"plaintext":      plaintext,
+				"format":         format,
+				"recipient_keys": []string{gpgPublicKey},
+			}).Data["ciphertext"]
+
+			// The recipients can check the signature while decrypting
+			for _, name := range []string{keyType, "other"} {
+				resp := request(logical.UpdateOperation, "decrypt/"+name, map[string]interface{}{
+					"ciphertext": signed,
+					"format":     format,
+					"signer_key": signerKey,
+				})
+				if resp.Data["plaintext"] != plaintext {
+					t.Fatalf("unexpected plaintext for %s key in %s: %v", keyType, format, resp.Data["plaintext"])
+				}
+			}
+			resp := testHandleRequest(t, b, storage, logical.UpdateOperation, "decrypt/other", map[string]interface{}{
+				"ciphertext": unsigned,
+				"format":     format,
+				"signer_key": signerKey,
+			})
+			if !resp.IsError() {
+				t.Fatalf("expected an unsigned ciphertext to fail the signature check")
+			}
+		}
+	}
+}
+
+func TestGPG_EncryptSignedHash(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	request := newTestRequest(t, b, storage)
+
+	// The signature of ECDSA keys uses a hash at least as long as the curve
+	request(logical.UpdateOperation, "keys/p521", map[string]interface{}{
+		"real_name": "Vault GPG test",
+		"key_type":  "ecdsa-p521",
+	})
+	plaintext := "QWxwYWNhcwo="
+	ciphertext := request(logical.UpdateOperation, "encrypt/p521", map[string]interface{}{
+		"plaintext": plaintext,
+		"sign":      true,
+	}).Data["ciphertext"].(string)
+	entity, _, err := b.readEntity(context.Background(), storage, "p521")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := openpgp.ReadMessage(bytes.NewReader(decoded), openpgp.EntityList{entity}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(md.UnverifiedBody); err != nil {
+		t.Fatal(err)
+	}
+	if md.SignatureError != nil || md.Signature.Hash != crypto.SHA512 {
+		t.Fatalf("expected a valid SHA-512 signature, got %v %v", md.SignatureError, md.Signature.Hash)
+	}
+
+	// An ECDSA signing subkey cannot sign when the recipients only accept
+	// shorter hashes
+	request(logical.UpdateOperation, "keys/rsa", map[string]interface{}{
+		"real_name": "Vault GPG test",
+		"key_bits":  2048,
+	})
+	request(logical.UpdateOperation, "keys/rsa/subkeys", map[string]interface{}{
+		"key_type": "ecdsa-p521",
+	})
+	if resp := testHandleRequest(t, b, storage, logical.UpdateOperation, "encrypt/rsa", map[string]interface{}{
+		"plaintext": plaintext,
+		"sign":      true,
+	}); !resp.IsError() {
+		t.Fatal("expected signing with a hash weaker than the curve to fail")
+	}
+	request(logical.UpdateOperation, "encrypt/rsa", map[string]interface{}{
+		"plaintext": plaintext,
+	})
+}
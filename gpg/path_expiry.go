@@ -0,0 +1,167 @@
+package gpg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func pathExpiry(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/expiry",
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the key.",
+			},
+			"expires": {
+				Type:        framework.TypeInt,
+				Default:     365 * 24 * 60 * 60,
+				Description: "The number of seconds from now after which the master key and the selected subkeys expire. If the number is zero, then they never expire.",
+			},
+			"subkeys": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "The Key IDs of the subkeys whose expiry to change, along with the master key.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathKeyExpiryWrite,
+			},
+		},
+		HelpSynopsis:    pathExpiryHelpSyn,
+		HelpDescription: pathExpiryHelpDesc,
+	}
+}
+
+func (b *backend) pathKeyExpiryWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	expires := data.Get("expires").(int)
+	if expires < 0 {
+		return logical.ErrorResponse("expires cannot be negative"), nil
+	}
+
+	lock := locksutil.LockForKey(b.keyLocks, name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	entry, entity, resp, err := b.writableEntity(ctx, req.Storage, name)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	var subkeys []*openpgp.Subkey
+	for _, keyID := range data.Get("subkeys").([]string) {
+		subkey, err := findSubkey(entity, keyID)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		if subkey == nil {
+			return logical.ErrorResponse("subkey %s does not exist", keyID), nil
+		}
+		if subkey.Sig.SigType == packet.SigTypeSubkeyRevocation {
+			return logical.ErrorResponse("subkey %s is revoked", keyID), nil
+		}
+		if subkey.PrivateKey == nil {
+			return logical.ErrorResponse("private key of subkey %s is missing", keyID), nil
+		}
+		subkeys = append(subkeys, subkey)
+	}
+
+	config := &packet.Config{}
+	now := config.Now()
+
+	// The expiry of the master key is in the self-signatures of its user IDs
+	lifetime, err := keyLifetime(entity.PrimaryKey.CreationTime, now, expires)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	for _, identity := range entity.Identities {
+		if identityRevocation(entity, identity) != nil {
+			continue
+		}
+		template := *identity.SelfSignature
+		template.KeyLifetimeSecs = lifetime
+		primary := identity.SelfSignature.IsPrimaryId != nil && *identity.SelfSignature.IsPrimaryId
+		if err := signIdentity(entity, identity, &template, primary, config); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, subkey := range subkeys {
+		lifetime, err := keyLifetime(subkey.PublicKey.CreationTime, now, expires)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		flags, ok := keyFlags(subkey.Sig)
+		if !ok {
+			return logical.ErrorResponse("subkey %s has no key flags", subkey.PublicKey.KeyIdString()), nil
+		}
+		var lifetimeSecs uint32
+		if lifetime != nil {
+			lifetimeSecs = *lifetime
+		}
+		sig, err := bindSubkey(entity, subkey.PrivateKey, flags, lifetimeSecs, config)
+		if err != nil {
+			return nil, err
+		}
+		subkey.Sig = sig
+	}
+
+	if err := b.setEntity(ctx, req.Storage, name, entry, entity); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, err
+	}
+	bindings, err := subkeyBindings(entry.SerializedKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := serializePublic(w, entity, bindings); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"public_key": buf.String(),
+		},
+	}, nil
+}
+
+// keyLifetime returns the lifetime of a key created at creationTime that
+// expires the given number of seconds after now, or nil if it never expires.
+func keyLifetime(creationTime, now time.Time, expires int) (*uint32, error) {
+	if expires == 0 {
+		return nil, nil
+	}
+	lifetime := int64(now.Sub(creationTime)/time.Second) + int64(expires)
+	if lifetime <= 0 || lifetime > math.MaxUint32 {
+		return nil, fmt.Errorf("expiry out of range")
+	}
+	secs := uint32(lifetime)
+	return &secs, nil
+}
+
+const pathExpiryHelpSyn = "Change the expiry of a named GPG key"
+const pathExpiryHelpDesc = `
+This path is used to change the expiry of the latest version of the named GPG
+key, and optionally of some of its subkeys. The self-signatures of the key and
+the binding signatures of the subkeys are issued again with the new expiry, and
+the updated public key is returned so that it can be published.
+`
@@ -0,0 +1,150 @@
+package gpg
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/openpgp"
+)
+
+func TestGPG_KeyExpiry(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	request := newTestRequest(t, b, storage)
+
+	request(logical.UpdateOperation, "keys/test", map[string]interface{}{
+		"real_name": "Vault GPG test",
+		"key_type":  "ecdsa-p256",
+		"expires":   3600,
+	})
+	request(logical.UpdateOperation, "keys/test/uids", map[string]interface{}{
+		"real_name": "Vault GPG test",
+		"email":     "vault@example.com",
+	})
+	signingKeyID := request(logical.UpdateOperation, "keys/test/subkeys", map[string]interface{}{
+		"key_type": "ed25519",
+		"expires":  60,
+	}).Data["key_id"].(string)
+
+	resp := request(logical.UpdateOperation, "keys/test/expiry", map[string]interface{}{
+		"expires": 7200,
+		"subkeys": strings.ToLower(signingKeyID),
+	})
+	el, err := openpgp.ReadArmoredKeyRing(strings.NewReader(resp.Data["public_key"].(string)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if el[0].PrivateKey != nil {
+		t.Fatal("private key should not be returned")
+	}
+
+	// Allow for the time spent between the creation and the update
+	inRange := func(lifetime *uint32) bool {
+		return lifetime != nil && *lifetime >= 7200 && *lifetime <= 7300
+	}
+	for uid, identity := range el[0].Identities {
+		if !inRange(identity.SelfSignature.KeyLifetimeSecs) {
+			t.Fatalf("unexpected lifetime for user ID %s", uid)
+		}
+		if len(identity.Signatures) != 1 {
+			t.Fatalf("expected the self-signature of user ID %s to be replaced, got %d signatures", uid, len(identity.Signatures))
+		}
+	}
+	if el[0].PrimaryIdentity().Name != "Vault GPG test" {
+		t.Fatalf("unexpected primary user ID: %s", el[0].PrimaryIdentity().Name)
+	}
+	for _, subkey := range el[0].Subkeys {
+		if subkey.PublicKey.KeyIdString() == signingKeyID {
+			if !inRange(subkey.Sig.KeyLifetimeSecs) || !subkey.Sig.FlagSign {
+				t.Fatalf("unexpected binding signature of the signing subkey: %#v", subkey.Sig)
+			}
+			if subkey.Sig.EmbeddedSignature == nil {
+				t.Fatal("expected the signing subkey to cross-certify the master key")
+			}
+		} else if subkey.Sig.KeyLifetimeSecs != nil {
+			t.Fatal("expected the encryption subkey to be unchanged")
+		}
+	}
+
+	resp = request(logical.ReadOperation, "keys/test/subkeys/"+signingKeyID, nil)
+	if expires := resp.Data["expires"].(uint32); expires < 7200 || expires > 7300 {
+		t.Fatalf("unexpected subkey expiry: %d", expires)
+	}
+
+	// The master key no longer expires
+	resp = request(logical.UpdateOperation, "keys/test/expiry", map[string]interface{}{
+		"expires": 0,
+	})
+	el, err = openpgp.ReadArmoredKeyRing(strings.NewReader(resp.Data["public_key"].(string)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if el[0].PrimaryIdentity().SelfSignature.KeyLifetimeSecs != nil {
+		t.Fatal("expected the master key to never expire")
+	}
+
+	// The key is still usable
+	input := "QWxwYWNhcwo="
+	signature := request(logical.UpdateOperation, "sign/test", map[string]interface{}{
+		"input": input,
+	}).Data["signature"]
+	resp = request(logical.UpdateOperation, "verify/test", map[string]interface{}{
+		"input":     input,
+		"signature": signature,
+	})
+	if resp.Data["valid"] != true {
+		t.Fatalf("expected signature to be valid: %v", resp.Data["error"])
+	}
+	ciphertext := request(logical.UpdateOperation, "encrypt/test", map[string]interface{}{
+		"plaintext": input,
+	}).Data["ciphertext"]
+	resp = request(logical.UpdateOperation, "decrypt/test", map[string]interface{}{
+		"ciphertext": ciphertext,
+	})
+	if resp.Data["plaintext"] != input {
+		t.Fatalf("unexpected plaintext: %v", resp.Data["plaintext"])
+	}
+}
+
+func TestGPG_KeyExpiryError(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/test",
+		Data: map[string]interface{}{
+			"real_name": "Vault GPG test",
+			"key_type":  "ed25519",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiryMustFail := func(keyName string, expires int, subkeys string) {
+		resp, _ := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      "keys/" + keyName + "/expiry",
+			Data: map[string]interface{}{
+				"expires": expires,
+				"subkeys": subkeys,
+			},
+		})
+		if !resp.IsError() {
+			t.Fatalf("expected to fail, keyname: %s, expires: %d, subkeys: %s", keyName, expires, subkeys)
+		}
+	}
+
+	expiryMustFail("doNotExist", 3600, "")
+	expiryMustFail("test", -1, "")
+	expiryMustFail("test", 1<<32, "")
+	expiryMustFail("test", 3600, "0123456789ABCDEF")
+	expiryMustFail("test", 3600, "ABCD")
+	expiryMustFail("test", 3600, "notHex")
+}
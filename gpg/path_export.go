@@ -3,10 +3,20 @@ package gpg
 import (
 	"bytes"
 	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1" // #nosec G505 -- RFC 4880 mandates SHA-1 for secret key checksums
+	"fmt"
+	"io"
+
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 	"golang.org/x/crypto/openpgp"
 	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+	"golang.org/x/crypto/openpgp/s2k"
 )
 
 func pathExportKeys(b *backend) *framework.Path {
@@ -17,19 +27,71 @@ func pathExportKeys(b *backend) *framework.Path {
 				Type:        framework.TypeString,
 				Description: "Name of the key",
 			},
+			"passphrase": {
+				Type:        framework.TypeString,
+				Description: "The passphrase with which to encrypt the secret parts of the exported key. If empty, the key is exported unencrypted.",
+			},
+			"s2k_cipher": {
+				Type:        framework.TypeLowerCaseString,
+				Default:     "aes256",
+				Description: `The cipher with which to encrypt the secret parts of the exported key. Can be "aes128", "aes192" or "aes256". Defaults to "aes256". Only used if passphrase is set.`,
+			},
+			"s2k_hash": {
+				Type:        framework.TypeLowerCaseString,
+				Default:     "sha256",
+				Description: `The hash of the iterated and salted S2K function. Can be "sha1", "sha256", "sha384" or "sha512". Defaults to "sha256". Only used if passphrase is set.`,
+			},
+			"s2k_count": {
+				Type:        framework.TypeInt,
+				Default:     65011712,
+				Description: "The number of bytes hashed by the iterated and salted S2K function, between 65536 and 65011712. Defaults to 65011712. Only used if passphrase is set.",
+			},
 		},
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.ReadOperation: &framework.PathOperation{
 				Callback: b.pathExportKeyRead,
 			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathExportKeyRead,
+			},
 		},
 		HelpSynopsis:    pathExportHelpSyn,
 		HelpDescription: pathExportHelpDesc,
 	}
 }
 
+var s2kCiphers = map[string]packet.CipherFunction{
+	"aes128": packet.CipherAES128,
+	"aes192": packet.CipherAES192,
+	"aes256": packet.CipherAES256,
+}
+
+var s2kHashes = map[string]crypto.Hash{
+	"sha1":   crypto.SHA1,
+	"sha256": crypto.SHA256,
+	"sha384": crypto.SHA384,
+	"sha512": crypto.SHA512,
+}
+
 func (b *backend) pathExportKeyRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	name := data.Get("name").(string)
+	passphrase := data.Get("passphrase").(string)
+	cipherFunc, ok := s2kCiphers[data.Get("s2k_cipher").(string)]
+	if !ok {
+		return logical.ErrorResponse("unsupported cipher %s", data.Get("s2k_cipher").(string)), nil
+	}
+	s2kConfig := &s2k.Config{
+		S2KMode:  3,
+		S2KCount: data.Get("s2k_count").(int),
+	}
+	s2kConfig.Hash, ok = s2kHashes[data.Get("s2k_hash").(string)]
+	if !ok {
+		return logical.ErrorResponse("unsupported hash %s", data.Get("s2k_hash").(string)), nil
+	}
+	if s2kConfig.S2KCount < 65536 || s2kConfig.S2KCount > 65011712 {
+		return logical.ErrorResponse("s2k_count must be between 65536 and 65011712"), nil
+	}
+
 	entry, err := b.key(ctx, req.Storage, name)
 	if err != nil {
 		return nil, err
@@ -41,12 +103,20 @@ func (b *backend) pathExportKeyRead(ctx context.Context, req *logical.Request, d
 		return logical.ErrorResponse("key is not exportable"), nil
 	}
 
+	serializedKey := entry.SerializedKey
+	if passphrase != "" {
+		serializedKey, err = encryptPrivateKeys(serializedKey, []byte(passphrase), cipherFunc, s2kConfig, rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	var buf bytes.Buffer
 	w, err := armor.Encode(&buf, openpgp.PrivateKeyType, nil)
 	if err != nil {
 		return nil, err
 	}
-	w.Write(entry.SerializedKey)
+	w.Write(serializedKey)
 	if w.Close() != nil {
 		return nil, err
 	}
@@ -59,5 +129,93 @@ func (b *backend) pathExportKeyRead(ctx context.Context, req *logical.Request, d
 	}, nil
 }
 
+// Packet tags of secret keys, see RFC 4880, section 4.3.
+const (
+	secretKeyPacketTag    = 5
+	secretSubkeyPacketTag = 7
+)
+
+// encryptPrivateKeys encrypts the secret parts of every private key of the
+// serialized keys with the passphrase, like GnuPG does: with an iterated and
+// salted S2K function and a SHA-1 checksum, see RFC 4880, section 5.5.3. The
+// other packets are copied as is. The openpgp library cannot be used since it
+// does not allow choosing the cipher nor the S2K parameters.
+func encryptPrivateKeys(serializedKey, passphrase []byte, cipherFunc packet.CipherFunction, config *s2k.Config, rand io.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	for rest := serializedKey; len(rest) > 0; {
+		tag, raw, body, next, err := nextPacket(rest)
+		if err != nil {
+			return nil, err
+		}
+		rest = next
+		if tag != secretKeyPacketTag && tag != secretSubkeyPacketTag {
+			buf.Write(raw)
+			continue
+		}
+
+		p, err := packet.Read(bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		pk, ok := p.(*packet.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("unable to parse private key")
+		}
+		if pk.Version != 4 {
+			return nil, fmt.Errorf("only v4 keys are supported")
+		}
+		var public bytes.Buffer
+		if err := pk.PublicKey.Serialize(&public); err != nil {
+			return nil, err
+		}
+		publicBody, err := packetBody(public.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		// The secret key material follows the public key, the S2K usage
+		// octet and is followed by a two-octet checksum.
+		publicLength := len(publicBody)
+		if len(body) < publicLength+3 || !bytes.Equal(body[:publicLength], publicBody) {
+			return nil, fmt.Errorf("unable to parse private key %s", pk.KeyIdString())
+		}
+		if body[publicLength] != 0 {
+			return nil, fmt.Errorf("private key %s is already encrypted", pk.KeyIdString())
+		}
+		secret := body[publicLength+1 : len(body)-2]
+
+		var encrypted bytes.Buffer
+		encrypted.Write(body[:publicLength])
+		encrypted.Write([]byte{254, byte(cipherFunc)})
+		key := make([]byte, cipherFunc.KeySize())
+		if err := s2k.Serialize(&encrypted, key, rand, passphrase, config); err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		iv := make([]byte, block.BlockSize())
+		if _, err := io.ReadFull(rand, iv); err != nil {
+			return nil, err
+		}
+		encrypted.Write(iv)
+
+		checksum := sha1.Sum(secret) // #nosec G401 -- RFC 4880 mandates SHA-1 for secret key checksums
+		plaintext := append(append([]byte{}, secret...), checksum[:]...)
+		ciphertext := make([]byte, len(plaintext))
+		cipher.NewCFBEncrypter(block, iv).XORKeyStream(ciphertext, plaintext)
+		encrypted.Write(ciphertext)
+
+		if err := serializePacket(&buf, tag, encrypted.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
 const pathExportHelpSyn = "Export named GPG key"
-const pathExportHelpDesc = "This path is used to export the keys that are configured as exportable."
+const pathExportHelpDesc = `
+This path is used to export the keys that are configured as exportable.
+If a passphrase is given, the secret parts of the exported key are encrypted
+with it, so that the key remains protected once imported into GnuPG.
+`
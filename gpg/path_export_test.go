@@ -1,9 +1,15 @@
 package gpg
 
 import (
+	"bytes"
 	"context"
-	"github.com/hashicorp/vault/sdk/logical"
+	"strings"
 	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
 )
 
 func TestGPG_ExportNotExistingKeyReturnsNotFound(t *testing.T) {
@@ -94,3 +100,131 @@ func TestGPG_ExportKey(t *testing.T) {
 		t.Fatalf("not expected name, expected test got: %s", name)
 	}
 }
+
+func TestGPG_ExportEncryptedKey(t *testing.T) {
+	storage := &logical.InmemStorage{}
+
+	b := Backend()
+
+	for _, keyType := range []string{"rsa", "ed25519", "ecdsa-p256"} {
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      "keys/" + keyType,
+			Data: map[string]interface{}{
+				"real_name":  "Vault GPG test",
+				"key_type":   keyType,
+				"exportable": true,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      "export/" + keyType,
+			Data: map[string]interface{}{
+				"passphrase": "correct horse",
+				"s2k_cipher": "aes128",
+				"s2k_hash":   "sha1",
+				"s2k_count":  65536,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.IsError() {
+			t.Fatalf("not expected error response: %#v", *resp)
+		}
+
+		el, err := openpgp.ReadArmoredKeyRing(strings.NewReader(resp.Data["key"].(string)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		entity := el[0]
+		privateKeys := []*packet.PrivateKey{entity.PrivateKey}
+		for _, subkey := range entity.Subkeys {
+			privateKeys = append(privateKeys, subkey.PrivateKey)
+		}
+		for _, pk := range privateKeys {
+			if !pk.Encrypted {
+				t.Fatalf("%s: expected private key %s to be encrypted", keyType, pk.KeyIdString())
+			}
+			if err := pk.Decrypt([]byte("wrong passphrase")); err == nil {
+				t.Fatalf("%s: expected decryption with a wrong passphrase to fail", keyType)
+			}
+			if err := pk.Decrypt([]byte("correct horse")); err != nil {
+				t.Fatalf("%s: unable to decrypt private key: %v", keyType, err)
+			}
+		}
+
+		// The decrypted key can be imported again
+		var buf bytes.Buffer
+		w, err := armor.Encode(&buf, openpgp.PrivateKeyType, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := serializePrivateWithoutSigning(w, entity, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      "keys/" + keyType + "-imported",
+			Data: map[string]interface{}{
+				"generate": false,
+				"key":      buf.String(),
+				"expires":  0,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.IsError() {
+			t.Fatalf("not expected error response: %#v", *resp)
+		}
+	}
+}
+
+func TestGPG_ExportEncryptedKeyError(t *testing.T) {
+	storage := &logical.InmemStorage{}
+
+	b := Backend()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/test",
+		Data: map[string]interface{}{
+			"real_name":  "Vault GPG test",
+			"key_type":   "ed25519",
+			"exportable": true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exportMustFail := func(data map[string]interface{}) {
+		data["passphrase"] = "correct horse"
+		resp, _ := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      "export/test",
+			Data:      data,
+		})
+		if !resp.IsError() {
+			t.Fatalf("expected to fail, data: %v", data)
+		}
+	}
+
+	exportMustFail(map[string]interface{}{"s2k_cipher": "cast5"})
+	exportMustFail(map[string]interface{}{"s2k_hash": "md5"})
+	exportMustFail(map[string]interface{}{"s2k_count": 1024})
+	exportMustFail(map[string]interface{}{"s2k_count": 1 << 30})
+}
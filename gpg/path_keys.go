@@ -6,7 +6,9 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/helper/locksutil"
 
@@ -14,6 +16,7 @@ import (
 	"github.com/hashicorp/vault/sdk/logical"
 	"golang.org/x/crypto/openpgp"
 	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/errors"
 	"golang.org/x/crypto/openpgp/packet"
 )
 
@@ -50,10 +53,15 @@ func pathKeys(b *backend) *framework.Path {
 				Type:        framework.TypeString,
 				Description: "The comment of the identity associated with the generated GPG key. Must not contain any of \"()<>\x00\". Only used if generate is false.",
 			},
+			"key_type": {
+				Type:        framework.TypeLowerCaseString,
+				Default:     "rsa",
+				Description: `The type of key to generate. Can be "rsa", "ed25519", "ecdsa-p256", "ecdsa-p384" or "ecdsa-p521". Defaults to "rsa". Only used if generate is true.`,
+			},
 			"key_bits": {
 				Type:        framework.TypeInt,
 				Default:     2048,
-				Description: "The number of bits to use. Only used if generate is true.",
+				Description: "The number of bits to use. Only used if generate is true and key_type is \"rsa\".",
 			},
 			"expires": {
 				Type:        framework.TypeInt,
@@ -62,7 +70,15 @@ func pathKeys(b *backend) *framework.Path {
 			},
 			"key": {
 				Type:        framework.TypeString,
-				Description: "The ASCII-armored GPG key to use. Only used if generate is false.",
+				Description: "The ASCII-armored GPG key to use. It may be a keyring of several keys, which are all used to decrypt and verify data. Only used if generate is false.",
+			},
+			"passphrase": {
+				Type:        framework.TypeString,
+				Description: "The passphrase protecting the secret parts of the ASCII-armored GPG key. Only used if generate is false.",
+			},
+			"default_key": {
+				Type:        framework.TypeString,
+				Description: "The key ID or fingerprint of the key of the ASCII-armored keyring used to sign and encrypt data. Defaults to the first key. Only used if generate is false.",
 			},
 			"exportable": {
 				Type:        framework.TypeBool,
@@ -104,9 +120,34 @@ func (b *backend) key(ctx context.Context, s logical.Storage, name string) (*key
 		return nil, err
 	}
 
+	// Keys stored before versioning was introduced only have one version
+	if result.LatestVersion == 0 {
+		result.LatestVersion = 1
+		result.MinDecryptionVersion = 1
+	}
+
+	// Keys stored before their times were tracked
+	if result.CreationTime.IsZero() {
+		e, err := b.entity(&result)
+		if err != nil {
+			return nil, err
+		}
+		if e != nil {
+			result.setKeyTimes(e)
+		}
+	}
+
 	return &result, nil
 }
 
+func (b *backend) setKey(ctx context.Context, s logical.Storage, name string, entry *keyEntry) error {
+	storageEntry, err := logical.StorageEntryJSON("key/"+name, entry)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, storageEntry)
+}
+
 func (b *backend) keyRing(entry *keyEntry) (keyRing openpgp.EntityList, err error) {
 	r := bytes.NewReader(entry.SerializedKey)
 	keyRing, err = openpgp.ReadKeyRing(r)
@@ -116,37 +157,172 @@ func (b *backend) keyRing(entry *keyEntry) (keyRing openpgp.EntityList, err erro
 	return
 }
 
-func (b *backend) readKeyRing(ctx context.Context, storage logical.Storage, name string) (keyRing openpgp.EntityList, exportable bool, err error) {
-	entry, err := b.key(ctx, storage, name)
+// setEntity serializes the entity as the default entity of the latest version
+// of the key, keeping the other entities of the keyring, and writes the key to
+// the storage.
+func (b *backend) setEntity(ctx context.Context, s logical.Storage, name string, entry *keyEntry, e *openpgp.Entity) error {
+	serializedKey, err := b.replaceEntity(entry, e)
 	if err != nil {
-		return
+		return err
 	}
-	if entry == nil {
-		return
+	entry.SerializedKey = serializedKey
+	entry.setKeyTimes(e)
+	return b.setKey(ctx, s, name, entry)
+}
+
+// replaceEntity serializes the keyring of the latest version of the key, with
+// the default entity replaced by e.
+func (b *backend) replaceEntity(entry *keyEntry, e *openpgp.Entity) ([]byte, error) {
+	keyRing, err := b.keyRing(entry)
+	if err != nil {
+		return nil, err
 	}
-	exportable = entry.Exportable
-	keyRing, err = b.keyRing(entry)
+	bindings, err := subkeyBindings(entry.SerializedKey)
 	if err != nil {
-		return
+		return nil, err
 	}
-	return
+	var buf bytes.Buffer
+	for i, member := range keyRing {
+		if i == entry.DefaultEntity {
+			member = e
+		}
+		if err := serializePrivateWithoutSigning(&buf, member, bindings); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
 }
 
-func (b *backend) readEntity(ctx context.Context, storage logical.Storage, name string) (entity *openpgp.Entity, exportable bool, err error) {
-	keyRing, exportable, err := b.readKeyRing(ctx, storage, name)
+// entity returns the default entity of the latest version of the key, which is
+// used to sign and encrypt data.
+func (b *backend) entity(entry *keyEntry) (*openpgp.Entity, error) {
+	keyRing, err := b.keyRing(entry)
 	if err != nil {
-		return nil, false, err
+		return nil, err
 	}
 	if len(keyRing) == 0 {
-		return nil, false, nil
+		return nil, nil
+	}
+	if entry.DefaultEntity < 0 || entry.DefaultEntity >= len(keyRing) {
+		return nil, fmt.Errorf("default entity %d not found in keyring of %d keys", entry.DefaultEntity, len(keyRing))
+	}
+	return keyRing[entry.DefaultEntity], nil
+}
+
+// findEntity returns the index of the entity of the keyring whose primary key
+// matches the given key ID or fingerprint.
+func findEntity(keyRing openpgp.EntityList, id string) (int, bool) {
+	for i, e := range keyRing {
+		if strings.EqualFold(id, e.PrimaryKey.KeyIdString()) || strings.EqualFold(id, hex.EncodeToString(e.PrimaryKey.Fingerprint[:])) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// decryptionKeyRing returns the keys of all the versions that can be used to
+// decrypt and verify data, latest version first. The version matching a given
+// key ID can then be selected with KeysById.
+func (b *backend) decryptionKeyRing(entry *keyEntry) (openpgp.EntityList, error) {
+	var keyRing openpgp.EntityList
+	for version := entry.LatestVersion; version >= entry.MinDecryptionVersion; version-- {
+		serializedKey := entry.SerializedKey
+		if version != entry.LatestVersion {
+			var ok bool
+			serializedKey, ok = entry.ArchivedKeys[version]
+			if !ok {
+				continue
+			}
+		}
+		el, err := openpgp.ReadKeyRing(bytes.NewReader(serializedKey))
+		if err != nil {
+			return nil, err
+		}
+		keyRing = append(keyRing, el...)
 	}
-	if len(keyRing) > 1 {
-		return nil, false, fmt.Errorf("keyring has %d > 1 keys", len(keyRing))
+	return keyRing, nil
+}
+
+func (b *backend) readEntity(ctx context.Context, storage logical.Storage, name string) (entity *openpgp.Entity, exportable bool, err error) {
+	entry, err := b.key(ctx, storage, name)
+	if err != nil || entry == nil {
+		return nil, false, err
+	}
+	entity, err = b.entity(entry)
+	if err != nil || entity == nil {
+		return nil, false, err
+	}
+	return entity, entry.Exportable, nil
+}
+
+// subkeyBindings returns the latest binding signature of each subkey found in
+// serialized keys, by subkey key ID.
+func subkeyBindings(serializedKey []byte) (map[uint64]*packet.Signature, error) {
+	bindings := make(map[uint64]*packet.Signature)
+	packets := packet.NewReader(bytes.NewReader(serializedKey))
+	var subkeyID uint64
+	inSubkey := false
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			return bindings, nil
+		}
+		if err != nil {
+			if _, ok := err.(errors.UnsupportedError); ok {
+				continue
+			}
+			return nil, err
+		}
+		switch p := p.(type) {
+		case *packet.PrivateKey:
+			inSubkey, subkeyID = p.IsSubkey, p.KeyId
+		case *packet.PublicKey:
+			inSubkey, subkeyID = p.IsSubkey, p.KeyId
+		case *packet.UserId:
+			inSubkey = false
+		case *packet.Signature:
+			if !inSubkey || p.SigType != packet.SigTypeSubkeyBinding {
+				continue
+			}
+			if binding, ok := bindings[subkeyID]; !ok || p.CreationTime.After(binding.CreationTime) {
+				bindings[subkeyID] = p
+			}
+		}
 	}
-	return keyRing[0], exportable, nil
 }
 
-func serializePrivateWithoutSigning(w io.Writer, e *openpgp.Entity) (err error) {
+// mergeSubkeyBindings adds the binding signatures found in serialized keys to
+// bindings, keeping the latest binding signature of each subkey.
+func mergeSubkeyBindings(bindings map[uint64]*packet.Signature, serializedKey []byte) error {
+	found, err := subkeyBindings(serializedKey)
+	if err != nil {
+		return err
+	}
+	for keyID, sig := range found {
+		if binding, ok := bindings[keyID]; !ok || sig.CreationTime.After(binding.CreationTime) {
+			bindings[keyID] = sig
+		}
+	}
+	return nil
+}
+
+// serializeSubkeySignatures writes the signatures of a subkey. The openpgp
+// library replaces the binding signature of a revoked subkey with its
+// revocation signature, so the binding signature is taken from bindings.
+func serializeSubkeySignatures(w io.Writer, subkey openpgp.Subkey, bindings map[uint64]*packet.Signature) error {
+	if subkey.Sig.SigType == packet.SigTypeSubkeyRevocation {
+		binding, ok := bindings[subkey.PublicKey.KeyId]
+		if !ok {
+			return fmt.Errorf("no binding signature found for revoked subkey %s", subkey.PublicKey.KeyIdString())
+		}
+		if err := binding.Serialize(w); err != nil {
+			return err
+		}
+	}
+	return subkey.Sig.Serialize(w)
+}
+
+func serializePrivateWithoutSigning(w io.Writer, e *openpgp.Entity, bindings map[uint64]*packet.Signature) (err error) {
 	foundPrivateKey := false
 
 	if e.PrivateKey != nil {
@@ -156,25 +332,35 @@ func serializePrivateWithoutSigning(w io.Writer, e *openpgp.Entity) (err error)
 			return
 		}
 	}
-	for _, ident := range e.Identities {
-		err = ident.UserId.Serialize(w)
+	for _, revocation := range e.Revocations {
+		err = revocation.Serialize(w)
 		if err != nil {
 			return
 		}
-		err = ident.SelfSignature.Serialize(w)
+	}
+	for _, ident := range e.Identities {
+		err = ident.UserId.Serialize(w)
 		if err != nil {
 			return
 		}
+		for _, sig := range ident.Signatures {
+			err = sig.Serialize(w)
+			if err != nil {
+				return
+			}
+		}
 	}
 	for _, subkey := range e.Subkeys {
 		if subkey.PrivateKey != nil {
 			foundPrivateKey = true
 			err = subkey.PrivateKey.Serialize(w)
-			if err != nil {
-				return
-			}
+		} else {
+			err = subkey.PublicKey.Serialize(w)
 		}
-		err = subkey.Sig.Serialize(w)
+		if err != nil {
+			return
+		}
+		err = serializeSubkeySignatures(w, subkey, bindings)
 		if err != nil {
 			return
 		}
@@ -187,9 +373,81 @@ func serializePrivateWithoutSigning(w io.Writer, e *openpgp.Entity) (err error)
 	return nil
 }
 
+// decryptPrivateKeys decrypts the private key and the private subkeys of the
+// entity with the passphrase, so that they are stored decrypted.
+func decryptPrivateKeys(e *openpgp.Entity, passphrase []byte) error {
+	privateKeys := []*packet.PrivateKey{e.PrivateKey}
+	for _, subkey := range e.Subkeys {
+		privateKeys = append(privateKeys, subkey.PrivateKey)
+	}
+	for _, pk := range privateKeys {
+		if pk == nil {
+			continue
+		}
+		if pk.Dummy() {
+			return fmt.Errorf("the secret material of key %s is not available", pk.KeyIdString())
+		}
+		if !pk.Encrypted {
+			continue
+		}
+		if len(passphrase) == 0 {
+			return fmt.Errorf("the private key %s is encrypted, a passphrase is required", pk.KeyIdString())
+		}
+		if err := pk.Decrypt(passphrase); err != nil {
+			return fmt.Errorf("the private key %s could not be decrypted, is the passphrase correct?", pk.KeyIdString())
+		}
+	}
+	return nil
+}
+
+// serializePublic writes the public part of the entity like Entity.Serialize,
+// including the revocation signatures that Entity.Serialize omits.
+func serializePublic(w io.Writer, e *openpgp.Entity, bindings map[uint64]*packet.Signature) error {
+	err := e.PrimaryKey.Serialize(w)
+	if err != nil {
+		return err
+	}
+	for _, revocation := range e.Revocations {
+		err = revocation.Serialize(w)
+		if err != nil {
+			return err
+		}
+	}
+	for _, ident := range e.Identities {
+		err = ident.UserId.Serialize(w)
+		if err != nil {
+			return err
+		}
+		for _, sig := range ident.Signatures {
+			err = sig.Serialize(w)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, subkey := range e.Subkeys {
+		err = subkey.PublicKey.Serialize(w)
+		if err != nil {
+			return err
+		}
+		err = serializeSubkeySignatures(w, subkey, bindings)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (b *backend) pathKeyRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	name := data.Get("name").(string)
-	entity, exportable, err := b.readEntity(ctx, req.Storage, name)
+	entry, err := b.key(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return logical.ErrorResponse("master key does not exist"), nil
+	}
+	entity, err := b.entity(entry)
 	if err != nil {
 		return nil, err
 	}
@@ -202,30 +460,91 @@ func (b *backend) pathKeyRead(ctx context.Context, req *logical.Request, data *f
 	if err != nil {
 		return nil, err
 	}
-	err = entity.Serialize(w)
-	if err != nil || w.Close() != nil {
+	bindings, err := subkeyBindings(entry.SerializedKey)
+	if err != nil {
+		return nil, err
+	}
+	keyRing, err := b.keyRing(entry)
+	if err != nil {
+		return nil, err
+	}
+	keys := []map[string]interface{}{}
+	for i, e := range keyRing {
+		if err := serializePublic(w, e, bindings); err != nil {
+			return nil, err
+		}
+		keys = append(keys, map[string]interface{}{
+			"key_id":      e.PrimaryKey.KeyIdString(),
+			"fingerprint": hex.EncodeToString(e.PrimaryKey.Fingerprint[:]),
+			"identities":  identities(e),
+			"default":     i == entry.DefaultEntity,
+		})
+	}
+	if err := w.Close(); err != nil {
 		return nil, err
 	}
 
+	subkeys := []map[string]interface{}{}
+	for _, subkey := range entity.Subkeys {
+		info, err := subkeyInfo(subkey, bindings)
+		if err != nil {
+			return nil, err
+		}
+		subkeys = append(subkeys, info)
+	}
+	keyBits, err := publicKeyBits(entity.PrimaryKey)
+	if err != nil {
+		return nil, err
+	}
+	capabilities := []string{}
+	if identity := entity.PrimaryIdentity(); identity != nil {
+		capabilities = keyCapabilities(identity.SelfSignature)
+	}
+
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"fingerprint": hex.EncodeToString(entity.PrimaryKey.Fingerprint[:]),
-			"public_key":  buf.String(),
-			"exportable":  exportable,
+			"key_id":                 entity.PrimaryKey.KeyIdString(),
+			"key_type":               keyTypeName(entity.PrimaryKey),
+			"key_bits":               keyBits,
+			"curve":                  publicKeyCurve(entity.PrimaryKey),
+			"capabilities":           capabilities,
+			"creation_time":          formatTime(entry.CreationTime),
+			"expiration_time":        formatTime(entry.ExpirationTime),
+			"subkeys":                subkeys,
+			"keys":                   keys,
+			"fingerprint":            hex.EncodeToString(entity.PrimaryKey.Fingerprint[:]),
+			"public_key":             buf.String(),
+			"exportable":             entry.Exportable,
+			"revoked":                len(entity.Revocations) > 0,
+			"identities":             identities(entity),
+			"latest_version":         entry.LatestVersion,
+			"min_decryption_version": entry.MinDecryptionVersion,
+			"min_available_version":  entry.MinAvailableVersion,
 		},
 	}, nil
 }
 
+// formatTime formats t as RFC 3339, or returns an empty string if t is zero.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
 func (b *backend) pathKeyCreate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	name := data.Get("name").(string)
 	realName := data.Get("real_name").(string)
 	email := data.Get("email").(string)
 	comment := data.Get("comment").(string)
+	keyType := data.Get("key_type").(string)
 	keyBits := data.Get("key_bits").(int)
 	expires := uint32(data.Get("expires").(int))
 	exportable := data.Get("exportable").(bool)
 	generate := data.Get("generate").(bool)
 	key := data.Get("key").(string)
+	passphrase := data.Get("passphrase").(string)
+	defaultKey := data.Get("default_key").(string)
 
 	lock := locksutil.LockForKey(b.keyLocks, name)
 	lock.Lock()
@@ -240,20 +559,24 @@ func (b *backend) pathKeyCreate(ctx context.Context, req *logical.Request, data
 	}
 
 	var buf bytes.Buffer
+	var created *openpgp.Entity
+	defaultEntity := 0
 	switch generate {
 	case true:
-		if keyBits < 2048 {
+		if err := validKeyType(keyType); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		if keyType == "rsa" && keyBits < 2048 {
 			return logical.ErrorResponse("Keys < 2048 bits are unsafe and not supported"), nil
 		}
 		config := packet.Config{
-			RSABits:         keyBits,
 			KeyLifetimeSecs: expires,
 		}
-		entity, err := openpgp.NewEntity(realName, comment, email, &config)
+		created, err = newEntity(realName, comment, email, keyType, keyBits, &config)
 		if err != nil {
 			return nil, err
 		}
-		err = entity.SerializePrivate(&buf, nil)
+		err = serializePrivateWithoutSigning(&buf, created, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -264,24 +587,51 @@ func (b *backend) pathKeyCreate(ctx context.Context, req *logical.Request, data
 		if expires > 0 {
 			return logical.ErrorResponse("cannot set expiry on an imported key"), nil
 		}
-		keyRing, err := openpgp.ReadArmoredKeyRing(strings.NewReader(key))
+		block, err := armor.Decode(strings.NewReader(key))
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		serializedKey, err := ioutil.ReadAll(block.Body)
 		if err != nil {
 			return logical.ErrorResponse(err.Error()), nil
 		}
-		err = serializePrivateWithoutSigning(&buf, keyRing[0])
+		keyRing, err := openpgp.ReadKeyRing(bytes.NewReader(serializedKey))
 		if err != nil {
-			return logical.ErrorResponse("the key could not be serialized, is a private key present?"), nil
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		bindings, err := subkeyBindings(serializedKey)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		if defaultKey != "" {
+			var ok bool
+			defaultEntity, ok = findEntity(keyRing, defaultKey)
+			if !ok {
+				return logical.ErrorResponse("default key %s not found in the keyring", defaultKey), nil
+			}
+		}
+		for _, e := range keyRing {
+			if err := decryptPrivateKeys(e, []byte(passphrase)); err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+			err = serializePrivateWithoutSigning(&buf, e, bindings)
+			if err != nil {
+				return logical.ErrorResponse("the key %s could not be serialized, is a private key present?", e.PrimaryKey.KeyIdString()), nil
+			}
 		}
+		created = keyRing[defaultEntity]
 	}
 
-	entry, err := logical.StorageEntryJSON("key/"+name, &keyEntry{
-		SerializedKey: buf.Bytes(),
-		Exportable:    exportable,
-	})
-	if err != nil {
-		return nil, err
+	entry := &keyEntry{
+		SerializedKey:        buf.Bytes(),
+		Exportable:           exportable,
+		LatestVersion:        1,
+		MinDecryptionVersion: 1,
+		DefaultEntity:        defaultEntity,
 	}
-	if err := req.Storage.Put(ctx, entry); err != nil {
+	entry.setKeyTimes(created)
+	err = b.setKey(ctx, req.Storage, name, entry)
+	if err != nil {
 		return nil, err
 	}
 	return nil, nil
@@ -294,7 +644,18 @@ func (b *backend) pathKeyDelete(ctx context.Context, req *logical.Request, data
 	lock.Lock()
 	defer lock.Unlock()
 
-	err := req.Storage.Delete(ctx, "key/"+name)
+	entry, err := b.key(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	if !entry.DeletionAllowed {
+		return logical.ErrorResponse("deletion is not allowed for this key"), nil
+	}
+
+	err = req.Storage.Delete(ctx, "key/"+name)
 	if err != nil {
 		return nil, err
 	}
@@ -311,8 +672,45 @@ func (b *backend) pathKeyList(
 }
 
 type keyEntry struct {
+	// SerializedKey is the latest version of the key
 	SerializedKey []byte
 	Exportable    bool
+
+	// ArchivedKeys holds the previous versions of the key, by version
+	ArchivedKeys         map[int][]byte
+	LatestVersion        int
+	MinDecryptionVersion int
+	MinAvailableVersion  int
+
+	// AllowPlaintextBackup allows the key to be backed up, it cannot be
+	// disabled once enabled
+	AllowPlaintextBackup bool
+
+	// DeletionAllowed allows the key to be deleted
+	DeletionAllowed bool
+
+	// DefaultEntity is the index of the entity used to sign and encrypt data
+	// in the keyring of the latest version of the key. The other entities are
+	// only used to decrypt and verify data.
+	DefaultEntity int
+
+	// CreationTime and ExpirationTime are those of the default entity of the
+	// latest version of the key. ExpirationTime is zero if the key does not expire.
+	CreationTime   time.Time
+	ExpirationTime time.Time
+}
+
+// setKeyTimes records the creation and expiration times of the entity, the
+// default entity of the latest version of the key.
+func (entry *keyEntry) setKeyTimes(e *openpgp.Entity) {
+	entry.CreationTime = e.PrimaryKey.CreationTime
+	entry.ExpirationTime = time.Time{}
+	if identity := e.PrimaryIdentity(); identity != nil {
+		lifetime := identity.SelfSignature.KeyLifetimeSecs
+		if lifetime != nil && *lifetime > 0 {
+			entry.ExpirationTime = e.PrimaryKey.CreationTime.Add(time.Duration(*lifetime) * time.Second)
+		}
+	}
 }
 
 const pathPolicyHelpSyn = "Managed named GPG keys"
@@ -0,0 +1,205 @@
+package gpg
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+func pathListPublicKeys(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "public-keys/?$",
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ListOperation: &framework.PathOperation{
+				Callback: b.pathPublicKeyList,
+			},
+		},
+		HelpSynopsis:    pathPublicKeysHelpSyn,
+		HelpDescription: pathPublicKeysHelpDesc,
+	}
+}
+
+func pathPublicKeys(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "public-keys/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the public key.",
+			},
+			"key": {
+				Type:        framework.TypeString,
+				Description: "The ASCII-armored GPG public key. It may be a keyring of several keys. Only the public parts of private keys are stored.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathPublicKeyRead,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathPublicKeyWrite,
+			},
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback: b.pathPublicKeyDelete,
+			},
+		},
+		HelpSynopsis:    pathPublicKeysHelpSyn,
+		HelpDescription: pathPublicKeysHelpDesc,
+	}
+}
+
+type publicKeyEntry struct {
+	// SerializedKey is the keyring of the public keys
+	SerializedKey []byte
+}
+
+func (b *backend) publicKey(ctx context.Context, s logical.Storage, name string) (*publicKeyEntry, error) {
+	entry, err := s.Get(ctx, "public-key/"+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result publicKeyEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// publicKeyRing returns the keys of all the named public keys. An error
+// response is returned if one of them does not exist.
+func (b *backend) publicKeyRing(ctx context.Context, s logical.Storage, names []string) (openpgp.EntityList, *logical.Response, error) {
+	var keyRing openpgp.EntityList
+	for _, name := range names {
+		entry, err := b.publicKey(ctx, s, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if entry == nil {
+			return nil, logical.ErrorResponse("public key %s does not exist", name), nil
+		}
+		el, err := openpgp.ReadKeyRing(bytes.NewReader(entry.SerializedKey))
+		if err != nil {
+			return nil, nil, err
+		}
+		keyRing = append(keyRing, el...)
+	}
+	return keyRing, nil, nil
+}
+
+func (b *backend) pathPublicKeyWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	key := data.Get("key").(string)
+	if key == "" {
+		return logical.ErrorResponse("the key value is required"), nil
+	}
+
+	block, err := armor.Decode(strings.NewReader(key))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	serializedKey, err := ioutil.ReadAll(block.Body)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	keyRing, err := openpgp.ReadKeyRing(bytes.NewReader(serializedKey))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	bindings, err := subkeyBindings(serializedKey)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	var buf bytes.Buffer
+	for _, e := range keyRing {
+		if err := serializePublic(&buf, e, bindings); err != nil {
+			return nil, err
+		}
+	}
+
+	storageEntry, err := logical.StorageEntryJSON("public-key/"+name, &publicKeyEntry{
+		SerializedKey: buf.Bytes(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, storageEntry); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) pathPublicKeyRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	entry, err := b.publicKey(ctx, req.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return logical.ErrorResponse("public key does not exist"), nil
+	}
+	keyRing, err := openpgp.ReadKeyRing(bytes.NewReader(entry.SerializedKey))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []map[string]interface{}{}
+	for _, e := range keyRing {
+		keys = append(keys, map[string]interface{}{
+			"key_id":      e.PrimaryKey.KeyIdString(),
+			"fingerprint": hex.EncodeToString(e.PrimaryKey.Fingerprint[:]),
+			"identities":  identities(e),
+			"revoked":     len(e.Revocations) > 0,
+		})
+	}
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(entry.SerializedKey); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"keys":       keys,
+			"public_key": buf.String(),
+		},
+	}, nil
+}
+
+func (b *backend) pathPublicKeyDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete(ctx, "public-key/"+data.Get("name").(string)); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) pathPublicKeyList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List(ctx, "public-key/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(entries), nil
+}
+
+const pathPublicKeysHelpSyn = "Manage the trusted GPG public keys"
+const pathPublicKeysHelpDesc = `
+This path is used to manage GPG public keys, such as the keys of partners.
+The public keys can be referenced by name to verify signatures with the verify
+and decrypt endpoints, and as recipients with the encrypt endpoint.
+`
@@ -0,0 +1,193 @@
+package gpg
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func TestGPG_PublicKeys(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	request := newTestRequest(t, b, storage)
+
+	request(logical.UpdateOperation, "keys/test", map[string]interface{}{
+		"real_name": "Vault GPG test",
+		"key_type":  "ed25519",
+	})
+	el, err := openpgp.ReadArmoredKeyRing(strings.NewReader(request(logical.ReadOperation, "keys/test", nil).Data["public_key"].(string)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the public parts of the partner key are stored
+	partner, err := newEntity("Partner", "", "partner@example.com", "ed25519", 0, &packet.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var armored bytes.Buffer
+	w, err := armor.Encode(&armored, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := serializePrivateWithoutSigning(w, partner, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	request(logical.UpdateOperation, "public-keys/partner", map[string]interface{}{
+		"key": armored.String(),
+	})
+	resp := request(logical.ReadOperation, "public-keys/partner", nil)
+	keys := resp.Data["keys"].([]map[string]interface{})
+	if len(keys) != 1 || keys[0]["key_id"] != partner.PrimaryKey.KeyIdString() || keys[0]["revoked"] != false {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+	stored, err := openpgp.ReadArmoredKeyRing(strings.NewReader(resp.Data["public_key"].(string)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0].PrivateKey != nil {
+		t.Fatal("expected a single public key")
+	}
+	resp = request(logical.ListOperation, "public-keys", nil)
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"partner"}) {
+		t.Fatalf("unexpected list: %v", resp.Data["keys"])
+	}
+
+	// Signatures of the partner are only accepted when its key is referenced
+	input := "QWxwYWNhcwo="
+	message, err := base64.StdEncoding.DecodeString(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signature bytes.Buffer
+	if err := openpgp.DetachSign(&signature, partner, bytes.NewReader(message), nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, signers := range []string{"", "partner"} {
+		resp = request(logical.UpdateOperation, "verify/test", map[string]interface{}{
+			"input":              input,
+			"signature":          base64.StdEncoding.EncodeToString(signature.Bytes()),
+			"signer_public_keys": signers,
+		})
+		if resp.Data["valid"] != (signers != "") {
+			t.Fatalf("unexpected validity with signers %q: %v", signers, resp.Data)
+		}
+	}
+
+	// The partner can decrypt data encrypted for it
+	ciphertext := request(logical.UpdateOperation, "encrypt/test", map[string]interface{}{
+		"plaintext":             input,
+		"recipient_public_keys": "partner",
+	}).Data["ciphertext"].(string)
+	decoded, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := openpgp.ReadMessage(bytes.NewReader(decoded), openpgp.EntityList{partner}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plaintext, message) {
+		t.Fatalf("unexpected plaintext: %s", plaintext)
+	}
+
+	// Data signed by the partner can be decrypted, and the signature is then
+	// required
+	for _, signer := range []*openpgp.Entity{partner, nil} {
+		var buf bytes.Buffer
+		pt, err := openpgp.Encrypt(&buf, el, signer, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pt.Write(message); err != nil {
+			t.Fatal(err)
+		}
+		if err := pt.Close(); err != nil {
+			t.Fatal(err)
+		}
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      "decrypt/test",
+			Data: map[string]interface{}{
+				"ciphertext":         base64.StdEncoding.EncodeToString(buf.Bytes()),
+				"signer_public_keys": "partner",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if signer != nil && resp.Data["plaintext"] != input {
+			t.Fatalf("unexpected response: %v", resp.Data)
+		}
+		if signer == nil && !resp.IsError() {
+			t.Fatal("expected unsigned ciphertext to be refused")
+		}
+	}
+
+	request(logical.DeleteOperation, "public-keys/partner", nil)
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.ReadOperation,
+		Path:      "public-keys/partner",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.IsError() {
+		t.Fatal("expected public key to be deleted")
+	}
+}
+
+func TestGPG_PublicKeysError(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/test",
+		Data: map[string]interface{}{
+			"real_name": "Vault GPG test",
+			"key_type":  "ed25519",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, data := range map[string]map[string]interface{}{
+		"public-keys/partner": {"key": "Not a key"},
+		"public-keys/other":   {},
+		"encrypt/test":        {"plaintext": "QWxwYWNhcwo=", "recipient_public_keys": "doNotExist"},
+		"verify/test":         {"input": "QWxwYWNhcwo=", "signature": "", "signer_public_keys": "doNotExist"},
+		"decrypt/test":        {"ciphertext": "", "signer_public_keys": "doNotExist"},
+	} {
+		resp, _ := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+		})
+		if !resp.IsError() {
+			t.Fatalf("expected to fail, path: %s, data: %v", path, data)
+		}
+	}
+}
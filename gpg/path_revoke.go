@@ -0,0 +1,162 @@
+package gpg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func pathRevoke(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/revoke",
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the key.",
+			},
+			"reason_code": {
+				Type:        framework.TypeInt,
+				Default:     0,
+				Description: "The reason for revocation. Can be 0 (no reason specified), 1 (key is superseded), 2 (key has been compromised) or 3 (key is retired and no longer used). Defaults to 0.",
+			},
+			"reason_text": {
+				Type:        framework.TypeString,
+				Description: "A human-readable explanation of the revocation.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathKeyRevokeWrite,
+			},
+		},
+		HelpSynopsis:    pathRevokeHelpSyn,
+		HelpDescription: pathRevokeHelpDesc,
+	}
+}
+
+func (b *backend) pathKeyRevokeWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	reason, err := revocationReason(data.Get("reason_code").(int))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	reasonText := data.Get("reason_text").(string)
+
+	lock := locksutil.LockForKey(b.keyLocks, name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	entry, err := b.key(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return logical.ErrorResponse("master key does not exist"), nil
+	}
+	entity, err := b.entity(entry)
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil {
+		return logical.ErrorResponse("master key does not exist"), nil
+	}
+	if len(entity.Revocations) > 0 {
+		return logical.ErrorResponse("master key is already revoked"), nil
+	}
+
+	sig, err := revokeKey(entity, reason, reasonText, &packet.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.setEntity(ctx, req.Storage, name, entry, entity); err != nil {
+		return nil, err
+	}
+
+	var revocation bytes.Buffer
+	w, err := armor.Encode(&revocation, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := sig.Serialize(w); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"revocation_certificate": revocation.String(),
+		},
+	}, nil
+}
+
+// revocationReason validates a key revocation reason code, see RFC 4880,
+// section 5.2.3.23.
+func revocationReason(code int) (packet.ReasonForRevocation, error) {
+	if code < int(packet.NoReason) || code > int(packet.KeyRetired) {
+		return 0, fmt.Errorf("unsupported reason code %d; must be 0, 1, 2 or 3", code)
+	}
+	return packet.ReasonForRevocation(code), nil
+}
+
+// revokeKey adds a key revocation signature to the entity. Entity.RevokeKey
+// of the openpgp library always sets the public key algorithm to RSA.
+func revokeKey(e *openpgp.Entity, reason packet.ReasonForRevocation, reasonText string, config *packet.Config) (*packet.Signature, error) {
+	reasonCode := uint8(reason)
+	sig := &packet.Signature{
+		Version:              e.PrimaryKey.Version,
+		CreationTime:         config.Now(),
+		SigType:              packet.SigTypeKeyRevocation,
+		PubKeyAlgo:           e.PrimaryKey.PubKeyAlgo,
+		Hash:                 signatureHash(config.Hash(), e.PrimaryKey),
+		RevocationReason:     &reasonCode,
+		RevocationReasonText: reasonText,
+		IssuerKeyId:          &e.PrimaryKey.KeyId,
+	}
+	if err := sig.RevokeKey(e.PrimaryKey, e.PrivateKey, config); err != nil {
+		return nil, err
+	}
+	e.Revocations = append(e.Revocations, sig)
+	return sig, nil
+}
+
+// revokeSubkey replaces the binding signature of the subkey by a subkey
+// revocation signature, like Entity.RevokeSubkey of the openpgp library does.
+// Entity.RevokeSubkey always sets the public key algorithm to RSA and does not
+// hash the primary key.
+func revokeSubkey(e *openpgp.Entity, sk *openpgp.Subkey, reason packet.ReasonForRevocation, reasonText string, config *packet.Config) error {
+	reasonCode := uint8(reason)
+	sig := &packet.Signature{
+		Version:              e.PrimaryKey.Version,
+		CreationTime:         config.Now(),
+		SigType:              packet.SigTypeSubkeyRevocation,
+		PubKeyAlgo:           e.PrimaryKey.PubKeyAlgo,
+		Hash:                 signatureHash(config.Hash(), e.PrimaryKey),
+		RevocationReason:     &reasonCode,
+		RevocationReasonText: reasonText,
+		IssuerKeyId:          &e.PrimaryKey.KeyId,
+	}
+	if err := sig.SignKey(sk.PublicKey, e.PrivateKey, config); err != nil {
+		return err
+	}
+	sk.Sig = sig
+	return nil
+}
+
+const pathRevokeHelpSyn = "Revoke named GPG key"
+const pathRevokeHelpDesc = `
+This path is used to revoke the latest version of the named GPG key. The
+revocation signature is stored with the key and returned ASCII-armored, so
+that it can be published. A revoked key cannot be used to sign nor encrypt
+data anymore. Signatures made before the revocation can still be verified,
+unless the key is revoked because it is compromised.
+`
@@ -0,0 +1,210 @@
+package gpg
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func TestGPG_RevokeKey(t *testing.T) {
+	for _, keyType := range []string{"rsa", "ed25519", "ecdsa-p384"} {
+		t.Run(keyType, func(t *testing.T) {
+			storage := &logical.InmemStorage{}
+			b := Backend()
+
+			request := newTestRequest(t, b, storage)
+
+			request(logical.UpdateOperation, "keys/test", map[string]interface{}{
+				"real_name": "Vault GPG test",
+				"key_type":  keyType,
+			})
+
+			input := "QWxwYWNhcwo="
+			signature := request(logical.UpdateOperation, "sign/test", map[string]interface{}{
+				"input": input,
+			}).Data["signature"]
+
+			resp := request(logical.UpdateOperation, "keys/test/revoke", map[string]interface{}{
+				"reason_code": 2,
+				"reason_text": "Key leaked",
+			})
+			if !strings.HasPrefix(resp.Data["revocation_certificate"].(string), "-----BEGIN PGP PUBLIC KEY BLOCK-----") {
+				t.Fatalf("expected an ASCII-armored revocation certificate, got: %v", resp.Data["revocation_certificate"])
+			}
+
+			resp = request(logical.ReadOperation, "keys/test", nil)
+			if resp.Data["revoked"] != true {
+				t.Fatal("expected key to be revoked")
+			}
+			el, err := openpgp.ReadArmoredKeyRing(strings.NewReader(resp.Data["public_key"].(string)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(el[0].Revocations) != 1 {
+				t.Fatalf("expected 1 revocation signature in public key, got %d", len(el[0].Revocations))
+			}
+			revocation := el[0].Revocations[0]
+			if *revocation.RevocationReason != uint8(packet.KeyCompromised) || revocation.RevocationReasonText != "Key leaked" {
+				t.Fatalf("unexpected revocation reason: %d %s", *revocation.RevocationReason, revocation.RevocationReasonText)
+			}
+
+			// Signatures made before the revocation of a compromised key are invalid
+			resp = request(logical.UpdateOperation, "verify/test", map[string]interface{}{
+				"input":     input,
+				"signature": signature,
+			})
+			if resp.Data["valid"] != false || resp.Data["reason"] != "revoked" {
+				t.Fatalf("expected signature to be revoked: %v", resp.Data)
+			}
+
+			for _, path := range []string{"sign/test", "encrypt/test"} {
+				resp = testHandleRequest(t, b, storage, logical.UpdateOperation, path, map[string]interface{}{
+					"input":     input,
+					"plaintext": input,
+				})
+				if !resp.IsError() {
+					t.Fatalf("expected %s to fail with a revoked key", path)
+				}
+			}
+			resp = testHandleRequest(t, b, storage, logical.UpdateOperation, "keys/test/revoke", nil)
+			if !resp.IsError() {
+				t.Fatal("expected revocation of a revoked key to fail")
+			}
+		})
+	}
+}
+
+func TestGPG_RevokeKeyError(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/test",
+		Data: map[string]interface{}{
+			"real_name": "Vault GPG test",
+			"key_type":  "ed25519",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revokeMustFail := func(keyName string, reasonCode int) {
+		resp, _ := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      "keys/" + keyName + "/revoke",
+			Data: map[string]interface{}{
+				"reason_code": reasonCode,
+			},
+		})
+		if !resp.IsError() {
+			t.Fatalf("expected to fail, keyname: %s, reason code: %d", keyName, reasonCode)
+		}
+	}
+
+	revokeMustFail("doNotExist", 0)
+	revokeMustFail("test", -1)
+	revokeMustFail("test", 32)
+}
+
+func TestGPG_VerifyRevokedKey(t *testing.T) {
+	input := "QWxwYWNhcwo="
+	for reason, validBefore := range map[packet.ReasonForRevocation]bool{
+		packet.NoReason:       true,
+		packet.KeySuperseded:  true,
+		packet.KeyCompromised: false,
+		packet.KeyRetired:     true,
+	} {
+		storage := &logical.InmemStorage{}
+		b := Backend()
+
+		request := newTestRequest(t, b, storage)
+
+		request(logical.UpdateOperation, "keys/test", map[string]interface{}{
+			"real_name": "Vault GPG test",
+			"key_type":  "ed25519",
+		})
+		signature := request(logical.UpdateOperation, "sign/test", map[string]interface{}{
+			"input": input,
+		}).Data["signature"]
+
+		// The revocation is made in the future, after the signature
+		entry, err := b.key(context.Background(), storage, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		entity, err := b.entity(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = revokeKey(entity, reason, "", &packet.Config{
+			Time: func() time.Time { return time.Now().Add(time.Hour) },
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.setEntity(context.Background(), storage, "test", entry, entity); err != nil {
+			t.Fatal(err)
+		}
+
+		resp := request(logical.UpdateOperation, "verify/test", map[string]interface{}{
+			"input":     input,
+			"signature": signature,
+		})
+		if resp.Data["valid"] != validBefore {
+			t.Errorf("unexpected verification of a signature made before a revocation for reason %d: %v", reason, resp.Data)
+		}
+		if !validBefore && resp.Data["reason"] != "revoked" {
+			t.Errorf("expected reason revoked for reason %d, got %v", reason, resp.Data["reason"])
+		}
+
+		// The revocations of the keyring are left untouched
+		decoded, err := base64.StdEncoding.DecodeString(signature.(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+		message, err := base64.StdEncoding.DecodeString(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyring := openpgp.EntityList{entity}
+		if _, err := checkDetachedSignature(keyring, nil, bytes.NewReader(message), decoded, nil, &packet.Config{}); validBefore != (err == nil) {
+			t.Errorf("unexpected verification error for reason %d: %v", reason, err)
+		}
+		if len(keyring[0].Revocations) != 1 {
+			t.Errorf("expected the revocation to be kept, got %d revocations", len(keyring[0].Revocations))
+		}
+	}
+	// A revocation with the default reason keeps older signatures valid
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	request := newTestRequest(t, b, storage)
+
+	request(logical.UpdateOperation, "keys/test", map[string]interface{}{
+		"real_name": "Vault GPG test",
+		"key_type":  "ed25519",
+	})
+	signature := request(logical.UpdateOperation, "sign/test", map[string]interface{}{
+		"input": input,
+	}).Data["signature"]
+	time.Sleep(time.Second)
+	request(logical.UpdateOperation, "keys/test/revoke", nil)
+	resp := request(logical.UpdateOperation, "verify/test", map[string]interface{}{
+		"input":     input,
+		"signature": signature,
+	})
+	if resp.Data["valid"] != true {
+		t.Fatalf("expected a signature made before the revocation to be valid: %v", resp.Data)
+	}
+}
@@ -0,0 +1,143 @@
+package gpg
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func pathRotate(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/rotate",
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the key.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathKeyRotateWrite,
+			},
+		},
+		HelpSynopsis:    pathRotateHelpSyn,
+		HelpDescription: pathRotateHelpDesc,
+	}
+}
+
+func (b *backend) pathKeyRotateWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	lock := locksutil.LockForKey(b.keyLocks, name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	entry, err := b.key(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return logical.ErrorResponse("master key does not exist"), nil
+	}
+	entity, err := b.entity(entry)
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil {
+		return logical.ErrorResponse("master key does not exist"), nil
+	}
+
+	// The new version uses the same identity, key type, size and expiration
+	keyType, err := publicKeyType(entity.PrimaryKey)
+	if err == nil {
+		err = validKeyType(keyType)
+	}
+	if err != nil {
+		return logical.ErrorResponse("cannot rotate key: %v", err), nil
+	}
+	keyBits, err := publicKeyBits(entity.PrimaryKey)
+	if err != nil {
+		return nil, err
+	}
+	if keyType == "rsa" && keyBits < 2048 {
+		return logical.ErrorResponse("cannot rotate key: keys < 2048 bits are unsafe and not supported"), nil
+	}
+	identity := entity.PrimaryIdentity()
+	if identity == nil {
+		return logical.ErrorResponse("cannot rotate key: no identity found"), nil
+	}
+	// The lifetime of the current version counts from its creation, so the
+	// new version is given what remains of it to expire at the same time.
+	// Creation times are serialized in seconds.
+	now := time.Now().Truncate(time.Second)
+	config := packet.Config{
+		Time: func() time.Time { return now },
+	}
+	if lifetime := identity.SelfSignature.KeyLifetimeSecs; lifetime != nil && *lifetime > 0 {
+		expiration := entity.PrimaryKey.CreationTime.Add(time.Duration(*lifetime) * time.Second)
+		remaining := expiration.Sub(now) / time.Second
+		if remaining <= 0 {
+			return logical.ErrorResponse("cannot rotate key: key has expired, extend its expiry first"), nil
+		}
+		config.KeyLifetimeSecs = uint32(remaining)
+	}
+
+	rotated, err := newEntity(identity.UserId.Name, identity.UserId.Comment, identity.UserId.Email, keyType, int(keyBits), &config)
+	if err != nil {
+		return nil, err
+	}
+	// The user IDs that are not revoked are carried over, unlike the subkeys
+	// which are replaced by the new encryption subkey
+	uids := []string{}
+	for uid, other := range entity.Identities {
+		if other != identity && identityRevocation(entity, other) == nil {
+			uids = append(uids, uid)
+		}
+	}
+	sort.Strings(uids)
+	for _, uid := range uids {
+		other := &openpgp.Identity{
+			Name:   uid,
+			UserId: entity.Identities[uid].UserId,
+		}
+		if err := signIdentity(rotated, other, rotated.PrimaryIdentity().SelfSignature, false, &config); err != nil {
+			return nil, err
+		}
+		rotated.Identities[uid] = other
+	}
+
+	// The other entities of the keyring are kept as they are
+	serializedKey, err := b.replaceEntity(entry, rotated)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.ArchivedKeys == nil {
+		entry.ArchivedKeys = make(map[int][]byte)
+	}
+	entry.ArchivedKeys[entry.LatestVersion] = entry.SerializedKey
+	entry.SerializedKey = serializedKey
+	entry.LatestVersion++
+	entry.setKeyTimes(rotated)
+	if err := b.setKey(ctx, req.Storage, name, entry); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+const pathRotateHelpSyn = "Rotate named GPG key"
+const pathRotateHelpDesc = `
+This path is used to rotate the named GPG key. A new key is generated with
+the same key type, size and expiration, and the user IDs that are not revoked.
+The new key only has an encryption subkey: the other subkeys are not carried
+over and must be created again. RSA keys smaller than 2048 bits cannot be
+rotated. The previous versions are kept and can still be used for decryption
+and verification, unless they are older than the minimum decryption version
+of the key.
+`
@@ -0,0 +1,279 @@
+package gpg
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func TestGPG_RotateKey(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	request := newTestRequest(t, b, storage)
+
+	request(logical.UpdateOperation, "keys/test", map[string]interface{}{
+		"real_name": "Vault GPG test",
+		"key_type":  "ed25519",
+	})
+	fingerprint := request(logical.ReadOperation, "keys/test", nil).Data["fingerprint"]
+
+	input := "QWxwYWNhcwo="
+	signature := request(logical.UpdateOperation, "sign/test", map[string]interface{}{
+		"input": input,
+	}).Data["signature"]
+	ciphertext := request(logical.UpdateOperation, "encrypt/test", map[string]interface{}{
+		"plaintext": input,
+	}).Data["ciphertext"]
+
+	for _, uid := range []string{"Second", "Revoked"} {
+		request(logical.UpdateOperation, "keys/test/uids", map[string]interface{}{
+			"real_name": uid,
+		})
+	}
+	request(logical.UpdateOperation, "keys/test/uids/revoke", map[string]interface{}{
+		"uid": "Revoked",
+	})
+	request(logical.UpdateOperation, "keys/test/subkeys", map[string]interface{}{
+		"key_type": "ed25519",
+	})
+
+	request(logical.UpdateOperation, "keys/test/rotate", nil)
+
+	resp := request(logical.ReadOperation, "keys/test", nil)
+	if resp.Data["latest_version"] != 2 {
+		t.Fatalf("expected latest version 2, got %v", resp.Data["latest_version"])
+	}
+	if resp.Data["fingerprint"] == fingerprint {
+		t.Fatal("expected a new fingerprint after rotation")
+	}
+
+	// The user IDs that are not revoked are carried over, but not the subkeys
+	resp = request(logical.ListOperation, "keys/test/uids", nil)
+	if uids := resp.Data["keys"].([]string); !reflect.DeepEqual(uids, []string{"Second", "Vault GPG test"}) {
+		t.Fatalf("unexpected user IDs: %v", uids)
+	}
+	if resp.Data["key_info"].(map[string]interface{})["Vault GPG test"].(map[string]interface{})["primary"] != true {
+		t.Fatalf("expected the primary user ID to be kept: %v", resp.Data["key_info"])
+	}
+	if keys := request(logical.ListOperation, "keys/test/subkeys", nil).Data["keys"].([]string); len(keys) != 1 {
+		t.Fatalf("expected a single subkey, got %v", keys)
+	}
+
+	verify := func(signature interface{}) bool {
+		return request(logical.UpdateOperation, "verify/test", map[string]interface{}{
+			"input":     input,
+			"signature": signature,
+		}).Data["valid"].(bool)
+	}
+	decrypt := func(ciphertext interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      "decrypt/test",
+			Data: map[string]interface{}{
+				"ciphertext": ciphertext,
+			},
+		})
+	}
+
+	// Previous versions can still decrypt and verify
+	if !verify(signature) {
+		t.Fatal("expected signature of version 1 to be valid")
+	}
+	if resp, err := decrypt(ciphertext); err != nil || resp.Data["plaintext"] != input {
+		t.Fatalf("unable to decrypt with version 1: %v %#v", err, resp)
+	}
+
+	// The latest version is used to sign and encrypt
+	newSignature := request(logical.UpdateOperation, "sign/test", map[string]interface{}{
+		"input": input,
+	}).Data["signature"]
+	newCiphertext := request(logical.UpdateOperation, "encrypt/test", map[string]interface{}{
+		"plaintext": input,
+	}).Data["ciphertext"]
+
+	request(logical.UpdateOperation, "keys/test/config", map[string]interface{}{
+		"min_decryption_version": 2,
+	})
+	if verify(signature) {
+		t.Fatal("expected signature of version 1 to be invalid")
+	}
+	if resp, _ := decrypt(ciphertext); !resp.IsError() {
+		t.Fatal("expected decryption with version 1 to fail")
+	}
+	if !verify(newSignature) {
+		t.Fatal("expected signature of version 2 to be valid")
+	}
+	if resp, err := decrypt(newCiphertext); err != nil || resp.Data["plaintext"] != input {
+		t.Fatalf("unable to decrypt with version 2: %v %#v", err, resp)
+	}
+
+	// Version 1 can be used again until it is deleted
+	request(logical.UpdateOperation, "keys/test/config", map[string]interface{}{
+		"min_decryption_version": 1,
+	})
+	if !verify(signature) {
+		t.Fatal("expected signature of version 1 to be valid")
+	}
+	request(logical.UpdateOperation, "keys/test/config", map[string]interface{}{
+		"min_decryption_version": 2,
+		"min_available_version":  2,
+	})
+	entry, err := b.key(context.Background(), storage, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entry.ArchivedKeys) != 0 {
+		t.Fatalf("expected version 1 to be deleted, got %d archived versions", len(entry.ArchivedKeys))
+	}
+
+	resp = request(logical.ReadOperation, "keys/test/config", nil)
+	for field, expected := range map[string]int{
+		"latest_version":         2,
+		"min_decryption_version": 2,
+		"min_available_version":  2,
+	} {
+		if resp.Data[field] != expected {
+			t.Errorf("expected %s %d, got %v", field, expected, resp.Data[field])
+		}
+	}
+}
+
+func TestGPG_RotateKeyExpiry(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	request := newTestRequest(t, b, storage)
+
+	// The lifetime of the imported key counts from its creation, years ago
+	request(logical.UpdateOperation, "keys/test", map[string]interface{}{
+		"generate": false,
+		"key":      gpgKey,
+		"expires":  0,
+	})
+	request(logical.UpdateOperation, "keys/test/expiry", map[string]interface{}{
+		"expires": 3600,
+	})
+	expirationTime := request(logical.ReadOperation, "keys/test", nil).Data["expiration_time"]
+
+	request(logical.UpdateOperation, "keys/test/rotate", nil)
+	resp := request(logical.ReadOperation, "keys/test", nil)
+	if resp.Data["latest_version"] != 2 || resp.Data["expiration_time"] != expirationTime {
+		t.Fatalf("expected the rotated key to expire at %v, got %v", expirationTime, resp.Data["expiration_time"])
+	}
+
+	// Expired keys cannot be rotated
+	request(logical.UpdateOperation, "keys/test/expiry", map[string]interface{}{
+		"expires": 1,
+	})
+	time.Sleep(2 * time.Second)
+	if resp := testHandleRequest(t, b, storage, logical.UpdateOperation, "keys/test/rotate", nil); !resp.IsError() {
+		t.Fatal("expected rotation of an expired key to fail")
+	}
+}
+
+func TestGPG_RotateKeyError(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	// Imported RSA keys smaller than 2048 bits cannot be rotated
+	entity, err := openpgp.NewEntity("Vault GPG test", "", "", &packet.Config{RSABits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.SerializePrivate(w, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/test",
+		Data: map[string]interface{}{
+			"generate": false,
+			"key":      buf.String(),
+			"expires":  0,
+		},
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("unable to import key: %v %#v", err, resp)
+	}
+
+	for _, name := range []string{"test", "doNotExist"} {
+		resp, _ := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      "keys/" + name + "/rotate",
+		})
+		if !resp.IsError() {
+			t.Fatalf("expected rotation of %s to fail", name)
+		}
+	}
+}
+
+func TestGPG_KeyConfigError(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/test",
+		Data: map[string]interface{}{
+			"real_name": "Vault GPG test",
+			"key_type":  "ed25519",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/test/rotate",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configMustFail := func(keyName string, data map[string]interface{}) {
+		resp, _ := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      "keys/" + keyName + "/config",
+			Data:      data,
+		})
+		if !resp.IsError() {
+			t.Fatalf("expected to fail, keyname: %s, data: %v", keyName, data)
+		}
+	}
+
+	configMustFail("doNotExist", map[string]interface{}{"min_decryption_version": 1})
+	configMustFail("test", map[string]interface{}{"min_decryption_version": 0})
+	configMustFail("test", map[string]interface{}{"min_decryption_version": 3})
+	configMustFail("test", map[string]interface{}{"min_available_version": 2})
+
+	resp, _ := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/doNotExist/rotate",
+	})
+	if !resp.IsError() {
+		t.Fatal("expected rotation of a missing key to fail")
+	}
+}
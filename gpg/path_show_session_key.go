@@ -1,7 +1,6 @@
 package gpg
 
 import (
-	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/hex"
@@ -66,8 +65,7 @@ func (b *backend) pathShowSessionKeyWrite(ctx context.Context, req *logical.Requ
 		return logical.ErrorResponse("key not found"), logical.ErrInvalidRequest
 	}
 
-	r := bytes.NewReader(keyEntry.SerializedKey)
-	keyring, err := openpgp.ReadKeyRing(r)
+	keyring, err := b.decryptionKeyRing(keyEntry)
 	if err != nil {
 		return nil, err
 	}
@@ -5,13 +5,23 @@ import (
 	"context"
 	"crypto"
 	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"golang.org/x/crypto/openpgp/errors"
 	"golang.org/x/crypto/openpgp/packet"
+	"golang.org/x/crypto/openpgp/s2k"
 )
 
 func pathSign(b *backend) *framework.Path {
@@ -41,7 +51,17 @@ Defaults to "sha2-256".`,
 			"format": {
 				Type:        framework.TypeString,
 				Default:     "base64",
-				Description: `Encoding format to use. Can be "base64" or "ascii-armor". Defaults to "base64".`,
+				Description: `Encoding format to use. Can be "base64" or "ascii-armor". Defaults to "base64". Only used if mode is "detached".`,
+			},
+			"mode": {
+				Type:        framework.TypeString,
+				Default:     "detached",
+				Description: `Signing mode. Can be "detached" for a detached signature, or "clearsign" for a cleartext signed message. Defaults to "detached".`,
+			},
+			"signature_type": {
+				Type:        framework.TypeString,
+				Default:     "binary",
+				Description: `Type of detached signature. Can be "binary", or "text" to sign the input as canonical text, with CRLF line endings. Defaults to "binary". Only used if mode is "detached".`,
 			},
 			"expires": {
 				Type:        framework.TypeInt,
@@ -52,6 +72,10 @@ Defaults to "sha2-256".`,
 				Type:        framework.TypeString,
 				Description: "The base64-encoded input data",
 			},
+			"key_id": {
+				Type:        framework.TypeString,
+				Description: "The key ID of the subkey, or of the master key, to sign with. Defaults to the newest valid signing subkey, or the master key if there is none.",
+			},
 		},
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.UpdateOperation: &framework.PathOperation{
@@ -82,7 +106,20 @@ func pathVerify(b *backend) *framework.Path {
 			"format": {
 				Type:        framework.TypeString,
 				Default:     "base64",
-				Description: `Encoding format the signature use. Can be "base64" or "ascii-armor". Defaults to "base64".`,
+				Description: `Encoding format the signature use. Can be "base64" or "ascii-armor". Defaults to "base64". Only used if mode is "detached".`,
+			},
+			"mode": {
+				Type:        framework.TypeString,
+				Default:     "detached",
+				Description: `Signing mode. Can be "detached" to verify a detached signature of the input, or "clearsign" to verify the cleartext signed message given as signature. Defaults to "detached".`,
+			},
+			"signer_key": {
+				Type:        framework.TypeString,
+				Description: "The ASCII-armored GPG public keys that are also accepted as signers.",
+			},
+			"signer_public_keys": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "The names of the stored public keys that are also accepted as signers.",
 			},
 		},
 		Operations: map[logical.Operation]framework.OperationHandler{
@@ -104,6 +141,9 @@ func (b *backend) pathSignWrite(ctx context.Context, req *logical.Request, data
 	if entity == nil {
 		return logical.ErrorResponse("master key does not exist"), nil
 	}
+	if len(entity.Revocations) > 0 {
+		return logical.ErrorResponse("master key is revoked"), nil
+	}
 
 	inputB64 := data.Get("input").(string)
 	input, err := base64.StdEncoding.DecodeString(inputB64)
@@ -113,6 +153,17 @@ func (b *backend) pathSignWrite(ctx context.Context, req *logical.Request, data
 	message := bytes.NewReader(input)
 
 	config := packet.Config{}
+	if keyIDHex := data.Get("key_id").(string); keyIDHex != "" {
+		keyID, err := hex.DecodeString(keyIDHex)
+		if err != nil || len(keyID) != 8 {
+			return logical.ErrorResponse("could not hex decode KeyID %s", keyIDHex), nil
+		}
+		entity, err = pinSigningKey(entity, binary.BigEndian.Uint64(keyID), config.Now())
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
 	algorithm := data.Get("urlalgorithm").(string)
 	if algorithm == "" {
 		algorithm = data.Get("algorithm").(string)
@@ -130,20 +181,59 @@ func (b *backend) pathSignWrite(ctx context.Context, req *logical.Request, data
 		return logical.ErrorResponse(fmt.Sprintf("unsupported algorithm %s", algorithm)), nil
 	}
 
+	// ECDSA keys on larger curves need a hash at least as long as the curve.
+	if signingKey, ok := entity.SigningKey(config.Now()); ok {
+		if hash := signatureHash(config.DefaultHash, signingKey.PublicKey); hash != config.DefaultHash {
+			_, explicit := data.GetOk("algorithm")
+			if explicit || data.Get("urlalgorithm").(string) != "" {
+				return logical.ErrorResponse(fmt.Sprintf("algorithm %s is too weak for the signing key", algorithm)), nil
+			}
+			config.DefaultHash = hash
+		}
+	}
+
 	expires := uint32(data.Get("expires").(int))
 	config.SigLifetimeSecs = expires
 
+	detachSign, armoredDetachSign := openpgp.DetachSign, openpgp.ArmoredDetachSign
+	switch signatureType := data.Get("signature_type").(string); signatureType {
+	case "binary":
+	case "text":
+		detachSign, armoredDetachSign = openpgp.DetachSignText, openpgp.ArmoredDetachSignText
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("unsupported signature type %s; must be \"binary\" or \"text\"", signatureType)), nil
+	}
+
+	switch mode := data.Get("mode").(string); mode {
+	case "detached":
+	case "clearsign":
+		if _, ok := entity.SigningKey(config.Now()); !ok {
+			return logical.ErrorResponse("no valid signing key found"), nil
+		}
+		signed, err := clearsignMessage(entity, input, &config)
+		if err != nil {
+			return nil, err
+		}
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"signature": signed,
+			},
+		}, nil
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("unsupported mode %s; must be \"detached\" or \"clearsign\"", mode)), nil
+	}
+
 	var signature bytes.Buffer
 	format := data.Get("format").(string)
 	switch format {
 	case "ascii-armor":
-		err = openpgp.ArmoredDetachSign(&signature, entity, message, &config)
+		err = armoredDetachSign(&signature, entity, message, &config)
 		if err != nil {
 			return nil, err
 		}
 	case "base64":
 		encoder := base64.NewEncoder(base64.StdEncoding, &signature)
-		err = openpgp.DetachSign(encoder, entity, message, &config)
+		err = detachSign(encoder, entity, message, &config)
 		if err != nil {
 			return nil, err
 		}
@@ -171,41 +261,415 @@ func (b *backend) pathVerifyWrite(ctx context.Context, req *logical.Request, dat
 		return logical.ErrorResponse("key not found"), logical.ErrInvalidRequest
 	}
 
-	r := bytes.NewReader(keyEntry.SerializedKey)
-	keyring, err := openpgp.ReadKeyRing(r)
+	// The source of each key of the keyring is reported if it matches, and
+	// the binding signatures of revoked subkeys are kept to check the
+	// signatures made before their revocation.
+	keyring, err := b.decryptionKeyRing(keyEntry)
 	if err != nil {
 		return nil, err
 	}
-
-	signature := strings.NewReader(data.Get("signature").(string))
-	inputB64 := data.Get("input").(string)
-	input, err := base64.StdEncoding.DecodeString(inputB64)
+	sources := make(map[*openpgp.Entity]signerSource)
+	for _, e := range keyring {
+		sources[e] = signerSource{"key", data.Get("name").(string)}
+	}
+	bindings, err := subkeyBindings(keyEntry.SerializedKey)
 	if err != nil {
-		return logical.ErrorResponse(fmt.Sprintf("unable to decode input as base64: %s", err)), logical.ErrInvalidRequest
+		return nil, err
+	}
+	for _, serializedKey := range keyEntry.ArchivedKeys {
+		if err := mergeSubkeyBindings(bindings, serializedKey); err != nil {
+			return nil, err
+		}
+	}
+	if signerKey := data.Get("signer_key").(string); signerKey != "" {
+		block, err := armor.Decode(strings.NewReader(signerKey))
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+		serializedKey, err := ioutil.ReadAll(block.Body)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+		el, err := openpgp.ReadKeyRing(bytes.NewReader(serializedKey))
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+		if err := mergeSubkeyBindings(bindings, serializedKey); err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+		for _, e := range el {
+			sources[e] = signerSource{"signer_key", ""}
+		}
+		keyring = append(keyring, el...)
+	}
+	for _, name := range data.Get("signer_public_keys").([]string) {
+		entry, err := b.publicKey(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			return logical.ErrorResponse("public key %s does not exist", name), nil
+		}
+		publicKeys, err := openpgp.ReadKeyRing(bytes.NewReader(entry.SerializedKey))
+		if err != nil {
+			return nil, err
+		}
+		if err := mergeSubkeyBindings(bindings, entry.SerializedKey); err != nil {
+			return nil, err
+		}
+		for _, e := range publicKeys {
+			sources[e] = signerSource{"public_key", name}
+		}
+		keyring = append(keyring, publicKeys...)
 	}
-	message := bytes.NewReader(input)
 
-	config := packet.Config{}
-	format := data.Get("format").(string)
-	switch format {
-	case "base64":
-		decoder := base64.NewDecoder(base64.StdEncoding, signature)
-		_, err = openpgp.CheckDetachedSignature(keyring, message, decoder, &config)
-	case "ascii-armor":
-		_, err = openpgp.CheckArmoredDetachedSignature(keyring, message, signature, &config)
+	var message io.Reader
+	var signature []byte
+	var signedText []byte
+	var expectedHashes []crypto.Hash
+	switch mode := data.Get("mode").(string); mode {
+	case "detached":
+		inputB64 := data.Get("input").(string)
+		input, err := base64.StdEncoding.DecodeString(inputB64)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("unable to decode input as base64: %s", err)), logical.ErrInvalidRequest
+		}
+		message = bytes.NewReader(input)
+
+		signatureEncoded := strings.NewReader(data.Get("signature").(string))
+		format := data.Get("format").(string)
+		switch format {
+		case "base64":
+			signature, err = ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, signatureEncoded))
+		case "ascii-armor":
+			var block *armor.Block
+			block, err = armor.Decode(signatureEncoded)
+			if err == nil && block.Type != openpgp.SignatureType {
+				err = fmt.Errorf("expected %s block, got %s", openpgp.SignatureType, block.Type)
+			}
+			if err == nil {
+				signature, err = ioutil.ReadAll(block.Body)
+			}
+		default:
+			return logical.ErrorResponse(fmt.Sprintf("unsupported encoding format %s; must be \"base64\" or \"ascii-armor\"", format)), nil
+		}
+	case "clearsign":
+		// The signed text is hashed with canonical line endings
+		block, _ := clearsign.Decode([]byte(data.Get("signature").(string)))
+		if block == nil {
+			err = fmt.Errorf("no cleartext signed message found")
+			break
+		}
+		message = bytes.NewReader(block.Bytes)
+		signedText = block.Plaintext
+		signature, err = ioutil.ReadAll(block.ArmoredSignature.Body)
+		if err == nil {
+			expectedHashes, err = clearsignHashes(block)
+		}
 	default:
-		return logical.ErrorResponse(fmt.Sprintf("unsupported encoding format %s; must be \"base64\" or \"ascii-armor\"", format)), nil
+		return logical.ErrorResponse(fmt.Sprintf("unsupported mode %s; must be \"detached\" or \"clearsign\"", mode)), nil
+	}
+	var signer *openpgp.Entity
+	if err == nil {
+		signer, err = checkDetachedSignature(keyring, bindings, message, signature, expectedHashes, &packet.Config{})
 	}
 
-	return &logical.Response{
+	resp := &logical.Response{
 		Data: map[string]interface{}{
 			"valid": err == nil,
-			"error": err,
 		},
-	}, nil
+	}
+	if err != nil {
+		resp.Data["error"] = err.Error()
+		resp.Data["reason"] = verificationFailure(err)
+	} else if signedText != nil {
+		resp.Data["plaintext"] = base64.StdEncoding.EncodeToString(signedText)
+	}
+	if sig := signaturePacket(keyring, signature); sig != nil {
+		for k, v := range signatureDetails(sig) {
+			resp.Data[k] = v
+		}
+		if signer != nil && sig.IssuerKeyId != nil {
+			resp.Data["signed_by_subkey"] = *sig.IssuerKeyId != signer.PrimaryKey.KeyId
+			for _, key := range signer.Subkeys {
+				if key.PublicKey.KeyId == *sig.IssuerKeyId {
+					resp.Data["issuer_fingerprint"] = hex.EncodeToString(key.PublicKey.Fingerprint[:])
+				}
+			}
+			if *sig.IssuerKeyId == signer.PrimaryKey.KeyId {
+				resp.Data["issuer_fingerprint"] = hex.EncodeToString(signer.PrimaryKey.Fingerprint[:])
+			}
+		}
+	}
+	if signer != nil {
+		resp.Data["signer"] = sources[signer].source
+		resp.Data["signer_name"] = sources[signer].name
+		resp.Data["signer_key_id"] = signer.PrimaryKey.KeyIdString()
+		resp.Data["signer_fingerprint"] = hex.EncodeToString(signer.PrimaryKey.Fingerprint[:])
+	}
+	return resp, nil
+}
+
+// clearsignMessage returns the input as a cleartext signed message, signed by
+// the signing key of the entity. clearsign.Encode ignores the lifetime of the
+// signature, so its signature is replaced by a text signature of the same
+// canonical text made with the config.
+func clearsignMessage(entity *openpgp.Entity, input []byte, config *packet.Config) (string, error) {
+	signingKey, ok := entity.SigningKey(config.Now())
+	if !ok {
+		return "", fmt.Errorf("no valid signing key found")
+	}
+	var signed bytes.Buffer
+	w, err := clearsign.Encode(&signed, signingKey.PrivateKey, config)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(input); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	block, _ := clearsign.Decode(signed.Bytes())
+	if block == nil {
+		return "", fmt.Errorf("no cleartext signed message found")
+	}
+	text := signed.Bytes()[:bytes.Index(signed.Bytes(), []byte("-----BEGIN "+openpgp.SignatureType))]
+
+	var signature bytes.Buffer
+	if err := openpgp.ArmoredDetachSignText(&signature, entity, bytes.NewReader(block.Bytes), config); err != nil {
+		return "", err
+	}
+	return string(text) + signature.String(), nil
+}
+
+// pinSigningKey returns a copy of the entity whose only signing key is the
+// master key or subkey with the given key ID, so that the openpgp library signs
+// with it. The key must be valid and able to sign.
+func pinSigningKey(e *openpgp.Entity, keyID uint64, now time.Time) (*openpgp.Entity, error) {
+	identity := e.PrimaryIdentity()
+	if identity == nil {
+		return nil, fmt.Errorf("no identity found")
+	}
+	if e.PrimaryKey.KeyExpired(identity.SelfSignature, now) {
+		return nil, fmt.Errorf("master key is expired")
+	}
+	pinned := *e
+	pinned.Subkeys = nil
+
+	if keyID == e.PrimaryKey.KeyId {
+		sig := identity.SelfSignature
+		if sig.FlagsValid && !sig.FlagSign || !e.PrimaryKey.PubKeyAlgo.CanSign() {
+			return nil, fmt.Errorf("master key %s cannot sign", e.PrimaryKey.KeyIdString())
+		}
+		return &pinned, nil
+	}
+
+	for _, subkey := range e.Subkeys {
+		if subkey.PublicKey.KeyId != keyID {
+			continue
+		}
+		switch {
+		case subkey.Sig.SigType == packet.SigTypeSubkeyRevocation:
+			return nil, fmt.Errorf("subkey %s is revoked", subkey.PublicKey.KeyIdString())
+		case subkey.PublicKey.KeyExpired(subkey.Sig, now):
+			return nil, fmt.Errorf("subkey %s is expired", subkey.PublicKey.KeyIdString())
+		case !subkey.Sig.FlagsValid || !subkey.Sig.FlagSign || !subkey.PublicKey.PubKeyAlgo.CanSign():
+			return nil, fmt.Errorf("subkey %s cannot sign", subkey.PublicKey.KeyIdString())
+		}
+		pinned.Subkeys = []openpgp.Subkey{subkey}
+		return &pinned, nil
+	}
+	return nil, fmt.Errorf("KeyID %016X does not correspond to the master key nor a subkey", keyID)
+}
+
+// verificationFailure returns the reason code of a signature verification
+// error.
+func verificationFailure(err error) string {
+	switch err.(type) {
+	case errors.SignatureError:
+		return "bad_signature"
+	}
+	switch err {
+	case errors.ErrUnknownIssuer:
+		return "unknown_signer"
+	case errors.ErrSignatureExpired, errors.ErrKeyExpired:
+		return "expired"
+	case errors.ErrKeyRevoked:
+		return "revoked"
+	}
+	return "malformed"
+}
+
+// signaturePacket returns the signature packet that is checked in a detached
+// signature: the first one made by a key of the keyring, or else the first
+// one.
+func signaturePacket(keyring openpgp.EntityList, signature []byte) *packet.Signature {
+	var first *packet.Signature
+	packets := packet.NewReader(bytes.NewReader(signature))
+	for {
+		p, err := packets.Next()
+		if err != nil {
+			return first
+		}
+		sig, ok := p.(*packet.Signature)
+		if !ok {
+			return first
+		}
+		if first == nil {
+			first = sig
+		}
+		if sig.IssuerKeyId != nil && len(keyring.KeysByIdUsage(*sig.IssuerKeyId, packet.KeyFlagSign)) > 0 {
+			return sig
+		}
+	}
+}
+
+// signatureDetails describes a signature, regardless of whether it is valid.
+func signatureDetails(sig *packet.Signature) map[string]interface{} {
+	issuerKeyID := ""
+	if sig.IssuerKeyId != nil {
+		issuerKeyID = fmt.Sprintf("%016X", *sig.IssuerKeyId)
+	}
+	expirationTime := ""
+	if sig.SigLifetimeSecs != nil && *sig.SigLifetimeSecs > 0 {
+		expirationTime = formatTime(sig.CreationTime.Add(time.Duration(*sig.SigLifetimeSecs) * time.Second))
+	}
+	signatureType := fmt.Sprintf("0x%02x", uint8(sig.SigType))
+	switch sig.SigType {
+	case packet.SigTypeBinary:
+		signatureType = "binary"
+	case packet.SigTypeText:
+		signatureType = "text"
+	}
+	return map[string]interface{}{
+		"issuer_key_id":   issuerKeyID,
+		"creation_time":   formatTime(sig.CreationTime),
+		"expiration_time": expirationTime,
+		"hash_algorithm":  hashAlgorithmName(sig.Hash),
+		"signature_type":  signatureType,
+		"notations":       signatureNotations(sig),
+	}
+}
+
+// clearsignHashes returns the hash algorithms listed by the Hash armor headers
+// of a cleartext signed message.
+func clearsignHashes(block *clearsign.Block) ([]crypto.Hash, error) {
+	var hashes []crypto.Hash
+	for _, name := range block.Headers["Hash"] {
+		known := false
+		for id := 0; id <= math.MaxUint8 && !known; id++ {
+			if hashName, ok := s2k.HashIdToString(byte(id)); ok && hashName == name {
+				h, _ := s2k.HashIdToHash(byte(id))
+				hashes = append(hashes, h)
+				known = true
+			}
+		}
+		if !known {
+			return nil, errors.StructuralError(fmt.Sprintf("unknown hash algorithm %s in cleartext message headers", name))
+		}
+	}
+	return hashes, nil
+}
+
+// hashAlgorithmName returns the name of a hash algorithm, as given to the
+// sign endpoint.
+func hashAlgorithmName(h crypto.Hash) string {
+	switch h {
+	case crypto.SHA224:
+		return "sha2-224"
+	case crypto.SHA256:
+		return "sha2-256"
+	case crypto.SHA384:
+		return "sha2-384"
+	case crypto.SHA512:
+		return "sha2-512"
+	case crypto.SHA1:
+		return "sha1"
+	}
+	return strings.ToLower(h.String())
+}
+
+// signerSource tells where a key accepted as a signer comes from: the named
+// key, the signer_key parameter, or a stored public key.
+type signerSource struct {
+	source string
+	name   string
+}
+
+// checkDetachedSignature verifies a detached signature like
+// openpgp.CheckDetachedSignature, except that signatures made before the
+// revocation of a superseded or retired signing key or subkey remain valid.
+// The binding signatures of revoked subkeys, which the openpgp library drops,
+// are given by subkey key ID. Like openpgp.CheckDetachedSignature, the signer
+// is also returned when the signature is valid but expired, or made by a
+// revoked key. Unless expectedHashes is empty, the signature must be made with
+// one of them, as checked by openpgp.CheckDetachedSignatureAndHash.
+func checkDetachedSignature(keyring openpgp.EntityList, bindings map[uint64]*packet.Signature, message io.Reader, signature []byte, expectedHashes []crypto.Hash, config *packet.Config) (*openpgp.Entity, error) {
+	// The openpgp library ignores revoked keys and subkeys, so the signature
+	// is checked against copies of the entities without their revocations.
+	unrevoked := make(openpgp.EntityList, 0, len(keyring))
+	originals := make(map[*openpgp.Entity]*openpgp.Entity)
+	subkeyRevocations := make(map[uint64]*packet.Signature)
+	unbound := make(map[uint64]*openpgp.Entity)
+	for _, e := range keyring {
+		c := *e
+		c.Revocations = nil
+		c.Subkeys = make([]openpgp.Subkey, 0, len(e.Subkeys))
+		for _, subkey := range e.Subkeys {
+			if subkey.Sig.SigType == packet.SigTypeSubkeyRevocation {
+				subkeyRevocations[subkey.PublicKey.KeyId] = subkey.Sig
+				binding, ok := bindings[subkey.PublicKey.KeyId]
+				if !ok {
+					unbound[subkey.PublicKey.KeyId] = e
+					continue
+				}
+				subkey.Sig = binding
+			}
+			c.Subkeys = append(c.Subkeys, subkey)
+		}
+		unrevoked = append(unrevoked, &c)
+		originals[&c] = e
+	}
+
+	// Without its binding signature, a revoked subkey cannot be checked
+	sig := signaturePacket(unrevoked, signature)
+	if sig != nil && sig.IssuerKeyId != nil && unbound[*sig.IssuerKeyId] != nil {
+		return unbound[*sig.IssuerKeyId], errors.ErrKeyRevoked
+	}
+
+	signer, err := openpgp.CheckDetachedSignatureAndHash(unrevoked, message, bytes.NewReader(signature), expectedHashes, config)
+	if signer == nil {
+		return nil, err
+	}
+	if err != nil {
+		return originals[signer], err
+	}
+	if sig == nil || revokedAt(originals[signer].Revocations, sig.CreationTime) {
+		return originals[signer], errors.ErrKeyRevoked
+	}
+	if revocation, ok := subkeyRevocations[*sig.IssuerKeyId]; ok && revokedAt([]*packet.Signature{revocation}, sig.CreationTime) {
+		return originals[signer], errors.ErrKeyRevoked
+	}
+	return originals[signer], nil
+}
+
+// revokedAt tells whether a key with the given revocation signatures is
+// revoked at time t. A compromised key is revoked at all times, but a key
+// revoked for another reason remains valid until its revocation.
+func revokedAt(revocations []*packet.Signature, t time.Time) bool {
+	for _, revocation := range revocations {
+		if revocation.RevocationReason != nil && packet.ReasonForRevocation(*revocation.RevocationReason) == packet.KeyCompromised {
+			return true
+		}
+		if t.After(revocation.CreationTime) {
+			return true
+		}
+	}
+	return false
 }
 
 const pathSignHelpSyn = "Generate a signature for input data using the named GPG key"
 const pathSignHelpDesc = "Generates a signature of the input data using the named GPG key."
 const pathVerifyHelpSyn = "Verify a signature for input data created using the named GPG key"
-const pathVerifyHelpDesc = "Verifies a signature of the input data using the named GPG key."
+const pathVerifyHelpDesc = "Verifies a signature of the input data using the named GPG key, or the given public keys."
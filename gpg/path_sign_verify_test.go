@@ -1,9 +1,21 @@
 package gpg
 
 import (
+	"bytes"
 	"context"
-	"github.com/hashicorp/vault/sdk/logical"
+	"crypto"
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
 )
 
 func TestGPG_SignVerify(t *testing.T) {
@@ -151,3 +163,672 @@ func TestGPG_SignVerify(t *testing.T) {
 	signRequest(req, "test", true, "")
 	verifyRequest(req, "test", true, false, signature)
 }
+
+func TestGPG_VerifyWithSignerKeys(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	request := newTestRequest(t, b, storage)
+
+	request(logical.UpdateOperation, "keys/test", map[string]interface{}{
+		"real_name": "Vault GPG test",
+		"key_type":  "ed25519",
+	})
+	input := "QWxwYWNhcwo="
+	message, err := base64.StdEncoding.DecodeString(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two vendors, one given inline and the other stored
+	var vendors []*openpgp.Entity
+	var armored []string
+	for _, name := range []string{"Inline vendor", "Stored vendor"} {
+		e, err := newEntity(name, "", "", "ed25519", 0, &packet.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Serialize(w); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		vendors = append(vendors, e)
+		armored = append(armored, buf.String())
+	}
+	request(logical.UpdateOperation, "public-keys/vendor", map[string]interface{}{
+		"key": armored[1],
+	})
+
+	ownSignature := request(logical.UpdateOperation, "sign/test", map[string]interface{}{
+		"input": input,
+	}).Data["signature"].(string)
+	entity, _, err := b.readEntity(context.Background(), storage, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signatures := []string{ownSignature}
+	for _, vendor := range vendors {
+		var signature bytes.Buffer
+		if err := openpgp.DetachSign(&signature, vendor, bytes.NewReader(message), nil); err != nil {
+			t.Fatal(err)
+		}
+		signatures = append(signatures, base64.StdEncoding.EncodeToString(signature.Bytes()))
+	}
+
+	for i, expected := range []struct {
+		signer *openpgp.Entity
+		source string
+		name   string
+	}{
+		{entity, "key", "test"},
+		{vendors[0], "signer_key", ""},
+		{vendors[1], "public_key", "vendor"},
+	} {
+		resp := request(logical.UpdateOperation, "verify/test", map[string]interface{}{
+			"input":              input,
+			"signature":          signatures[i],
+			"signer_key":         armored[0],
+			"signer_public_keys": "vendor",
+		})
+		if resp.Data["valid"] != true {
+			t.Fatalf("expected signature %d to be valid: %v", i, resp.Data["error"])
+		}
+		if resp.Data["signer"] != expected.source || resp.Data["signer_name"] != expected.name || resp.Data["signer_key_id"] != expected.signer.PrimaryKey.KeyIdString() {
+			t.Fatalf("unexpected signer of signature %d: %v", i, resp.Data)
+		}
+	}
+
+	// Vendor signatures are not valid unless their keys are given
+	resp := request(logical.UpdateOperation, "verify/test", map[string]interface{}{
+		"input":     input,
+		"signature": signatures[1],
+	})
+	if resp.Data["valid"] != false || resp.Data["signer"] != nil {
+		t.Fatalf("expected signature to be invalid: %v", resp.Data)
+	}
+}
+
+func TestGPG_VerifyDetails(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	request := newTestRequest(t, b, storage)
+	verify := func(input string, signature []byte) *logical.Response {
+		return request(logical.UpdateOperation, "verify/test", map[string]interface{}{
+			"input":     input,
+			"signature": base64.StdEncoding.EncodeToString(signature),
+		})
+	}
+
+	request(logical.UpdateOperation, "keys/test", map[string]interface{}{
+		"real_name": "Vault GPG test",
+		"key_type":  "ed25519",
+	})
+	input := "QWxwYWNhcwo="
+	message, err := base64.StdEncoding.DecodeString(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entity, _, err := b.readEntity(context.Background(), storage, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Signature by the primary key, with notations
+	now := time.Now().Truncate(time.Second)
+	fingerprint, keyID := issuerSubpackets(&entity.PrivateKey.PublicKey)
+	notation := []byte{0x80, 0, 0, 0, 0, 16, 0, 5}
+	notation = append(notation, []byte("test@example.com")...)
+	notation = append(notation, []byte("hello")...)
+	h := crypto.SHA384.New()
+	h.Write(message)
+	sig, err := signWithSubpackets(h, packet.SigTypeBinary, entity.PrivateKey, crypto.SHA384, []subpacket{
+		creationTimeSubpacket(now),
+		fingerprint,
+		{subpacketNotationData, notation},
+	}, []subpacket{keyID}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signature bytes.Buffer
+	if err := sig.Serialize(&signature); err != nil {
+		t.Fatal(err)
+	}
+	resp := verify(input, signature.Bytes())
+	expected := map[string]interface{}{
+		"valid":              true,
+		"issuer_key_id":      entity.PrimaryKey.KeyIdString(),
+		"issuer_fingerprint": hex.EncodeToString(entity.PrimaryKey.Fingerprint[:]),
+		"signed_by_subkey":   false,
+		"creation_time":      formatTime(now),
+		"expiration_time":    "",
+		"hash_algorithm":     "sha2-384",
+		"signature_type":     "binary",
+	}
+	for k, v := range expected {
+		if resp.Data[k] != v {
+			t.Errorf("expected %s to be %v, got %v", k, v, resp.Data[k])
+		}
+	}
+	notations := resp.Data["notations"].([]map[string]interface{})
+	if len(notations) != 1 || notations[0]["name"] != "test@example.com" || notations[0]["value"] != "hello" || notations[0]["human_readable"] != true {
+		t.Errorf("unexpected notations: %v", notations)
+	}
+	if _, ok := resp.Data["reason"]; ok {
+		t.Errorf("unexpected reason for a valid signature: %v", resp.Data["reason"])
+	}
+
+	// Malformed notations are skipped
+	h = crypto.SHA256.New()
+	h.Write(message)
+	sig, err = signWithSubpackets(h, packet.SigTypeBinary, entity.PrivateKey, crypto.SHA256, []subpacket{
+		creationTimeSubpacket(now),
+		fingerprint,
+		{subpacketNotationData, []byte{0x80, 0, 0, 0, 0, 16, 0, 42}},
+		{subpacketNotationData, notation},
+	}, []subpacket{keyID}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature.Reset()
+	if err := sig.Serialize(&signature); err != nil {
+		t.Fatal(err)
+	}
+	resp = verify(input, signature.Bytes())
+	notations = resp.Data["notations"].([]map[string]interface{})
+	if resp.Data["valid"] != true || len(notations) != 1 || notations[0]["name"] != "test@example.com" {
+		t.Errorf("unexpected verification of a signature with a malformed notation: %v", resp.Data)
+	}
+
+	// Signature by a signing subkey, with an expiry
+	subkeyID := request(logical.UpdateOperation, "keys/test/subkeys", map[string]interface{}{
+		"key_type":     "ed25519",
+		"capabilities": []string{"sign"},
+	}).Data["key_id"]
+	signatureB64 := request(logical.UpdateOperation, "sign/test", map[string]interface{}{
+		"input":   input,
+		"expires": 3600,
+	}).Data["signature"].(string)
+	resp = request(logical.UpdateOperation, "verify/test", map[string]interface{}{
+		"input":     input,
+		"signature": signatureB64,
+	})
+	if resp.Data["valid"] != true || resp.Data["signed_by_subkey"] != true || resp.Data["issuer_key_id"] != subkeyID || resp.Data["signer_key_id"] != entity.PrimaryKey.KeyIdString() {
+		t.Fatalf("unexpected verification of subkey signature: %v", resp.Data)
+	}
+	creationTime, err := time.Parse(time.RFC3339, resp.Data["creation_time"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["expiration_time"] != formatTime(creationTime.Add(time.Hour)) {
+		t.Errorf("unexpected expiration time: %v", resp.Data["expiration_time"])
+	}
+
+	// Invalid signatures carry a reason code
+	vendor, err := newEntity("Vendor", "", "", "ed25519", 0, &packet.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(signer *openpgp.Entity, message []byte) []byte {
+		var signature bytes.Buffer
+		if err := openpgp.DetachSign(&signature, signer, bytes.NewReader(message), nil); err != nil {
+			t.Fatal(err)
+		}
+		return signature.Bytes()
+	}
+	// The signature expiration time subpacket (type 3) gives a lifetime of an
+	// hour to a signature made two hours ago
+	h = crypto.SHA256.New()
+	h.Write(message)
+	sig, err = signWithSubpackets(h, packet.SigTypeBinary, entity.PrivateKey, crypto.SHA256, []subpacket{
+		creationTimeSubpacket(now.Add(-2 * time.Hour)),
+		{3, []byte{0, 0, 0x0e, 0x10}},
+		fingerprint,
+	}, []subpacket{keyID}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expiredSignature bytes.Buffer
+	if err := sig.Serialize(&expiredSignature); err != nil {
+		t.Fatal(err)
+	}
+	for reason, signature := range map[string][]byte{
+		"unknown_signer": sign(vendor, message),
+		"bad_signature":  sign(entity, []byte("Not the input")),
+		"expired":        expiredSignature.Bytes(),
+		"malformed":      []byte("Not a signature"),
+	} {
+		resp := verify(input, signature)
+		if resp.Data["valid"] != false || resp.Data["reason"] != reason || resp.Data["error"] == "" {
+			t.Errorf("expected reason %s, got %v", reason, resp.Data)
+		}
+	}
+
+	// Signatures made after the revocation of the key
+	entry, err := b.key(context.Background(), storage, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := b.entity(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = revokeKey(revoked, packet.KeyCompromised, "", &packet.Config{
+		Time: func() time.Time { return now.Add(-time.Hour) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.setEntity(context.Background(), storage, "test", entry, revoked); err != nil {
+		t.Fatal(err)
+	}
+	resp = verify(input, sign(entity, message))
+	if resp.Data["valid"] != false || resp.Data["reason"] != "revoked" || resp.Data["signer_key_id"] != entity.PrimaryKey.KeyIdString() {
+		t.Errorf("expected reason revoked, got %v", resp.Data)
+	}
+}
+
+func TestGPG_SignVerifyClearsign(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	request := newTestRequest(t, b, storage)
+
+	request(logical.UpdateOperation, "keys/test", map[string]interface{}{
+		"real_name": "Vault GPG test",
+		"key_type":  "ed25519",
+	})
+	text := "Origin: Vault\n- dashed line\n"
+	signed := request(logical.UpdateOperation, "sign/test", map[string]interface{}{
+		"input": base64.StdEncoding.EncodeToString([]byte(text)),
+		"mode":  "clearsign",
+	}).Data["signature"].(string)
+	if !strings.HasPrefix(signed, "-----BEGIN PGP SIGNED MESSAGE-----\nHash: SHA256\n\nOrigin: Vault\n- - dashed line\n-----BEGIN PGP SIGNATURE-----") {
+		t.Fatalf("unexpected cleartext signed message: %s", signed)
+	}
+
+	resp := request(logical.UpdateOperation, "verify/test", map[string]interface{}{
+		"signature": signed,
+		"mode":      "clearsign",
+	})
+	if resp.Data["valid"] != true || resp.Data["signature_type"] != "text" {
+		t.Fatalf("expected signature to be valid: %v", resp.Data)
+	}
+	plaintext, err := base64.StdEncoding.DecodeString(resp.Data["plaintext"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != text {
+		t.Fatalf("unexpected signed text: %q", plaintext)
+	}
+
+	// The signature expires like detached signatures
+	for _, expires := range []int{3600, 0} {
+		resp = request(logical.UpdateOperation, "verify/test", map[string]interface{}{
+			"signature": request(logical.UpdateOperation, "sign/test", map[string]interface{}{
+				"input":   base64.StdEncoding.EncodeToString([]byte(text)),
+				"mode":    "clearsign",
+				"expires": expires,
+			}).Data["signature"],
+			"mode": "clearsign",
+		})
+		if resp.Data["valid"] != true {
+			t.Fatalf("expected signature to be valid: %v", resp.Data)
+		}
+		expirationTime := ""
+		if expires != 0 {
+			creationTime, err := time.Parse(time.RFC3339, resp.Data["creation_time"].(string))
+			if err != nil {
+				t.Fatal(err)
+			}
+			expirationTime = creationTime.Add(time.Duration(expires) * time.Second).Format(time.RFC3339)
+		}
+		if resp.Data["expiration_time"] != expirationTime {
+			t.Fatalf("expected expiration time %q, got %v", expirationTime, resp.Data["expiration_time"])
+		}
+	}
+	expiring := request(logical.UpdateOperation, "sign/test", map[string]interface{}{
+		"input":   base64.StdEncoding.EncodeToString([]byte(text)),
+		"mode":    "clearsign",
+		"expires": 1,
+	}).Data["signature"]
+	time.Sleep(2 * time.Second)
+	resp = request(logical.UpdateOperation, "verify/test", map[string]interface{}{
+		"signature": expiring,
+		"mode":      "clearsign",
+	})
+	if resp.Data["valid"] != false || resp.Data["reason"] != "expired" {
+		t.Fatalf("expected reason expired, got %v", resp.Data)
+	}
+
+	// The signed text is not returned if the signature is not valid
+	for reason, message := range map[string]string{
+		"bad_signature": strings.Replace(signed, "Origin: Vault", "Origin: Mallory", 1),
+		"malformed":     text,
+	} {
+		resp = request(logical.UpdateOperation, "verify/test", map[string]interface{}{
+			"signature": message,
+			"mode":      "clearsign",
+		})
+		if resp.Data["valid"] != false || resp.Data["reason"] != reason || resp.Data["plaintext"] != nil {
+			t.Fatalf("expected reason %s, got %v", reason, resp.Data)
+		}
+	}
+
+	// The Hash armor header must list the hash algorithm of the signature
+	for header, reason := range map[string]string{
+		"Hash: SHA256\n":          "",
+		"Hash: SHA1, SHA256\n":    "",
+		"":                        "",
+		"Hash: SHA512\n":          "malformed",
+		"Hash: SHA1\nHash: MD5\n": "malformed",
+		"Hash: SHA3\n":            "malformed",
+	} {
+		resp = request(logical.UpdateOperation, "verify/test", map[string]interface{}{
+			"signature": strings.Replace(signed, "Hash: SHA256\n", header, 1),
+			"mode":      "clearsign",
+		})
+		if reason == "" && resp.Data["valid"] != true {
+			t.Errorf("expected signature with header %q to be valid: %v", header, resp.Data)
+		}
+		if reason != "" && (resp.Data["valid"] != false || resp.Data["reason"] != reason) {
+			t.Errorf("expected reason %s with header %q, got %v", reason, header, resp.Data)
+		}
+	}
+
+	for _, path := range []string{"sign/test", "verify/test"} {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data: map[string]interface{}{
+				"input": base64.StdEncoding.EncodeToString([]byte(text)),
+				"mode":  "inline",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !resp.IsError() {
+			t.Fatalf("expected %s to fail with an unsupported mode", path)
+		}
+	}
+}
+
+func TestGPG_SignVerifyText(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	request := newTestRequest(t, b, storage)
+
+	request(logical.UpdateOperation, "keys/test", map[string]interface{}{
+		"real_name": "Vault GPG test",
+		"key_type":  "ed25519",
+	})
+	unix := base64.StdEncoding.EncodeToString([]byte("First line\nSecond line\n"))
+	windows := base64.StdEncoding.EncodeToString([]byte("First line\r\nSecond line\r\n"))
+
+	// Text signatures are valid regardless of line endings, binary ones are not
+	for _, signatureType := range []string{"text", "binary"} {
+		for _, format := range []string{"base64", "ascii-armor"} {
+			signature := request(logical.UpdateOperation, "sign/test", map[string]interface{}{
+				"input":          unix,
+				"format":         format,
+				"signature_type": signatureType,
+			}).Data["signature"]
+			for _, input := range []string{unix, windows} {
+				resp := request(logical.UpdateOperation, "verify/test", map[string]interface{}{
+					"input":     input,
+					"signature": signature,
+					"format":    format,
+				})
+				expected := signatureType == "text" || input == unix
+				if resp.Data["valid"] != expected || resp.Data["signature_type"] != signatureType {
+					t.Fatalf("unexpected verification of %s signature in %s: %v", signatureType, format, resp.Data)
+				}
+			}
+		}
+	}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "sign/test",
+		Data: map[string]interface{}{
+			"input":          unix,
+			"signature_type": "canonical",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.IsError() {
+		t.Fatal("expected an unsupported signature type to fail")
+	}
+}
+
+func TestGPG_SignWithKeyID(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	request := newTestRequest(t, b, storage)
+
+	request(logical.UpdateOperation, "keys/test", map[string]interface{}{
+		"real_name": "Vault GPG test",
+		"key_type":  "ed25519",
+	})
+	input := "QWxwYWNhcwo="
+	entity, _, err := b.readEntity(context.Background(), storage, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSubkey := func(data map[string]interface{}) string {
+		return request(logical.UpdateOperation, "keys/test/subkeys", data).Data["key_id"].(string)
+	}
+	first := newSubkey(map[string]interface{}{"key_type": "ed25519"})
+	second := newSubkey(map[string]interface{}{"key_type": "ed25519"})
+	revoked := newSubkey(map[string]interface{}{"key_type": "ed25519"})
+	request(logical.UpdateOperation, "keys/test/subkeys/"+revoked+"/revoke", nil)
+	encryption := newSubkey(map[string]interface{}{
+		"key_type":     "rsa",
+		"key_bits":     2048,
+		"capabilities": []string{"encrypt"},
+	})
+
+	// The signature is made by the requested key, in every mode
+	for _, keyID := range []string{entity.PrimaryKey.KeyIdString(), first, second} {
+		for _, mode := range []string{"detached", "clearsign"} {
+			signature := request(logical.UpdateOperation, "sign/test", map[string]interface{}{
+				"input":  input,
+				"key_id": keyID,
+				"mode":   mode,
+			}).Data["signature"]
+			data := map[string]interface{}{
+				"signature": signature,
+				"mode":      mode,
+			}
+			if mode == "detached" {
+				data["input"] = input
+			}
+			resp := request(logical.UpdateOperation, "verify/test", data)
+			if resp.Data["valid"] != true || resp.Data["issuer_key_id"] != keyID {
+				t.Fatalf("expected a valid signature by %s in %s mode, got %v", keyID, mode, resp.Data)
+			}
+		}
+	}
+
+	for _, keyID := range []string{revoked, encryption, "0000000000000000", "not hex", "0102"} {
+		resp := testHandleRequest(t, b, storage, logical.UpdateOperation, "sign/test", map[string]interface{}{
+			"input":  input,
+			"key_id": keyID,
+		})
+		if !resp.IsError() {
+			t.Errorf("expected signing with %s to fail", keyID)
+		}
+	}
+
+	// Expired subkeys cannot be pinned
+	expiring := newSubkey(map[string]interface{}{
+		"key_type": "ed25519",
+		"expires":  3600,
+	})
+	entity, _, err = b.readEntity(context.Background(), storage, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := strconv.ParseUint(expiring, 16, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pinSigningKey(entity, id, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pinSigningKey(entity, id, time.Now().Add(2*time.Hour)); err == nil {
+		t.Fatal("expected an expired subkey to be refused")
+	}
+}
+
+func TestGPG_VerifyRevokedSubkey(t *testing.T) {
+	input := "QWxwYWNhcwo="
+	for _, test := range []struct {
+		reason      packet.ReasonForRevocation
+		revokedIn   time.Duration
+		valid       bool
+		description string
+	}{
+		{packet.KeySuperseded, time.Hour, true, "signature before the revocation of a superseded subkey"},
+		{packet.KeyRetired, time.Hour, true, "signature before the revocation of a retired subkey"},
+		{packet.KeySuperseded, -time.Hour, false, "signature after the revocation of a superseded subkey"},
+		{packet.KeyCompromised, time.Hour, false, "signature before the revocation of a compromised subkey"},
+		{packet.NoReason, time.Hour, true, "signature before the revocation of a subkey without reason"},
+		{packet.NoReason, -time.Hour, false, "signature after the revocation of a subkey without reason"},
+	} {
+		storage := &logical.InmemStorage{}
+		b := Backend()
+
+		request := newTestRequest(t, b, storage)
+
+		request(logical.UpdateOperation, "keys/test", map[string]interface{}{
+			"real_name": "Vault GPG test",
+			"key_type":  "ed25519",
+		})
+		subkeyID := request(logical.UpdateOperation, "keys/test/subkeys", map[string]interface{}{
+			"key_type": "ed25519",
+		}).Data["key_id"].(string)
+		signature := request(logical.UpdateOperation, "sign/test", map[string]interface{}{
+			"input": input,
+		}).Data["signature"]
+
+		entry, err := b.key(context.Background(), storage, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		entity, err := b.entity(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range entity.Subkeys {
+			if entity.Subkeys[i].PublicKey.KeyIdString() != subkeyID {
+				continue
+			}
+			err := revokeSubkey(entity, &entity.Subkeys[i], test.reason, "", &packet.Config{
+				Time: func() time.Time { return time.Now().Add(test.revokedIn) },
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := b.setEntity(context.Background(), storage, "test", entry, entity); err != nil {
+			t.Fatal(err)
+		}
+
+		resp := request(logical.UpdateOperation, "verify/test", map[string]interface{}{
+			"input":     input,
+			"signature": signature,
+		})
+		if resp.Data["valid"] != test.valid || resp.Data["issuer_key_id"] != subkeyID {
+			t.Errorf("unexpected verification of a %s: %v", test.description, resp.Data)
+		}
+		if !test.valid && resp.Data["reason"] != "revoked" {
+			t.Errorf("expected reason revoked for a %s, got %v", test.description, resp.Data["reason"])
+		}
+	}
+
+	// Subkeys revoked through the API
+	storage := &logical.InmemStorage{}
+	b := Backend()
+	request := newTestRequest(t, b, storage)
+	request(logical.UpdateOperation, "keys/test", map[string]interface{}{
+		"real_name": "Vault GPG test",
+		"key_type":  "ed25519",
+	})
+	subkeyID := request(logical.UpdateOperation, "keys/test/subkeys", map[string]interface{}{
+		"key_type": "ed25519",
+	}).Data["key_id"].(string)
+	signature := request(logical.UpdateOperation, "sign/test", map[string]interface{}{
+		"input": input,
+	}).Data["signature"]
+	request(logical.UpdateOperation, "keys/test/subkeys/"+subkeyID+"/revoke", map[string]interface{}{
+		"reason_code": 2,
+	})
+	resp := request(logical.UpdateOperation, "verify/test", map[string]interface{}{
+		"input":     input,
+		"signature": signature,
+	})
+	if resp.Data["valid"] != false || resp.Data["reason"] != "revoked" || resp.Data["signer_key_id"] == nil {
+		t.Errorf("expected reason revoked, got %v", resp.Data)
+	}
+
+	// The binding signature of the revoked subkey is needed to check the
+	// signature, which is otherwise reported as revoked
+	entity, _, err := b.readEntity(context.Background(), storage, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := base64.StdEncoding.DecodeString(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(signature.(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := checkDetachedSignature(openpgp.EntityList{entity}, nil, bytes.NewReader(message), decoded, nil, &packet.Config{})
+	if err != errors.ErrKeyRevoked || signer != entity {
+		t.Errorf("expected the subkey to be revoked, got %v", err)
+	}
+}
+
+func TestGPG_PacketBody(t *testing.T) {
+	cases := []struct {
+		packet []byte
+		body   []byte
+	}{
+		{[]byte{0xc2, 2, 4, 1}, []byte{4, 1}},
+		{[]byte{0xc2, 255, 0, 0, 0, 2, 4, 1}, []byte{4, 1}},
+		{[]byte{0x88, 2, 4, 1}, []byte{4, 1}},
+		{[]byte{0x89, 0, 2, 4, 1}, []byte{4, 1}},
+		// Partial body lengths, truncated packets and invalid headers
+		{[]byte{0xc2, 224, 4}, nil},
+		{[]byte{0xc2, 254, 4}, nil},
+		{[]byte{0xc2, 255, 0, 0, 0, 3, 4, 1}, nil},
+		{[]byte{0x42, 2, 4, 1}, nil},
+	}
+	for _, c := range cases {
+		body, err := packetBody(c.packet)
+		if c.body == nil && err == nil {
+			t.Errorf("expected %x to be rejected, got body %x", c.packet, body)
+		}
+		if c.body != nil && (err != nil || !bytes.Equal(body, c.body)) {
+			t.Errorf("expected body %x of %x, got %x: %v", c.body, c.packet, body, err)
+		}
+	}
+}
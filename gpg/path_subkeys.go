@@ -1,14 +1,14 @@
 package gpg
 
 import (
-	"bytes"
 	"context"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
-	"reflect"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
 	"github.com/hashicorp/vault/sdk/logical"
 	"golang.org/x/crypto/openpgp"
 	"golang.org/x/crypto/openpgp/packet"
@@ -36,8 +36,42 @@ func pathSubkeysRD(b *backend) *framework.Path {
 				Callback: b.pathSubkeyRead,
 			},
 		},
-		HelpSynopsis:    "Read and delete the given subkey under the given master key",
-		HelpDescription: "This path is used to read and delete the given subkey under the given master key.",
+		HelpSynopsis: "Read the given subkey under the given master key",
+		HelpDescription: `This path is used to read the given subkey under the given master key.
+Subkeys cannot be deleted, since whoever has the public key would keep using them: revoke them instead.`,
+	}
+}
+
+func pathSubkeysRevoke(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/subkeys/" + framework.GenericNameRegex("key_id") + "/revoke",
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "The name of the master key of the subkey.",
+			},
+			"key_id": {
+				Type:        framework.TypeString,
+				Description: "The Key ID of the subkey.",
+			},
+			"reason_code": {
+				Type:        framework.TypeInt,
+				Default:     0,
+				Description: "The reason for revocation. Can be 0 (no reason specified), 1 (key is superseded), 2 (key has been compromised) or 3 (key is retired and no longer used). Defaults to 0.",
+			},
+			"reason_text": {
+				Type:        framework.TypeString,
+				Description: "A human-readable explanation of the revocation.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathSubkeyRevoke,
+			},
+		},
+		HelpSynopsis: "Revoke the given subkey under the given master key",
+		HelpDescription: `This path is used to revoke the given subkey under the given master key.
+The revoked subkey is kept in the public key, along with its revocation signature.`,
 	}
 }
 
@@ -53,17 +87,17 @@ func pathSubkeysCL(b *backend) *framework.Path {
 			"key_type": {
 				Type:        framework.TypeLowerCaseString,
 				Default:     "rsa",
-				Description: "The subkey type.",
+				Description: `The subkey type. Can be "rsa", "ed25519", "ecdsa-p256", "ecdsa-p384" or "ecdsa-p521". Defaults to "rsa".`,
 			},
 			"capabilities": {
 				Type:        framework.TypeCommaStringSlice,
 				Default:     []string{"sign"},
-				Description: "The capabilities of the subkey.",
+				Description: `The capabilities of the subkey. Can contain "sign", "encrypt" and "authenticate". Only RSA subkeys can combine encryption with other capabilities.`,
 			},
 			"key_bits": {
 				Type:        framework.TypeInt,
 				Default:     4096,
-				Description: "The number of bits of the generated subkey.",
+				Description: "The number of bits of the generated subkey. Only used if key_type is \"rsa\".",
 			},
 			"expires": {
 				Type:        framework.TypeInt,
@@ -81,7 +115,8 @@ func pathSubkeysCL(b *backend) *framework.Path {
 		},
 		HelpSynopsis: "Create and list subkeys under the given master key",
 		HelpDescription: `This path is used to create and list subkeys under the given master key.
-Doing a write with no value against an existing master key will create by default a new, randomly-generated signing subkey.`,
+Doing a write with no value against an existing master key will create by default a new, randomly-generated signing subkey.
+Encryption and authentication subkeys can be created by setting the capabilities.`,
 	}
 }
 
@@ -93,46 +128,46 @@ func (b *backend) pathSubkeyCreate(ctx context.Context, req *logical.Request, da
 	expires := uint32(data.Get("expires").(int))
 
 	config := packet.Config{}
-	if keyBits < 2048 {
-		return logical.ErrorResponse("asymmetric subkeys < 2048 bits are unsafe"), nil
+	if err := validKeyType(keyType); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
 	}
-	config.RSABits = keyBits
-	if keyType != "rsa" {
-		return logical.ErrorResponse("non-RSA subkeys are not yet supported"), nil
+	if keyType == "rsa" && keyBits < 2048 {
+		return logical.ErrorResponse("asymmetric subkeys < 2048 bits are unsafe"), nil
 	}
-	config.Algorithm = packet.PubKeyAlgoRSA
-	if !reflect.DeepEqual(capabilities, []string{"sign"}) {
-		return logical.ErrorResponse("capabilities other than signing are not yet supported: " + fmt.Sprintf("%v", capabilities)), nil
+	if err := validCapabilities(keyType, capabilities); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
 	}
 	config.KeyLifetimeSecs = expires
 
-	entity, exportable, err := b.readEntity(ctx, req.Storage, name)
+	lock := locksutil.LockForKey(b.keyLocks, name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	entry, err := b.key(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return logical.ErrorResponse("master key does not exist"), nil
+	}
+	entity, err := b.entity(entry)
 	if err != nil {
 		return nil, err
 	}
 	if entity == nil {
 		return logical.ErrorResponse("master key does not exist"), nil
 	}
+	if len(entity.Revocations) > 0 {
+		return logical.ErrorResponse("master key is revoked"), nil
+	}
 
-	err = entity.AddSigningSubkey(&config)
+	err = addSubkey(entity, keyType, keyBits, capabilities, &config)
 	if err != nil {
-		return logical.ErrorResponse("could not add signing subkey"), err
+		return logical.ErrorResponse("could not add subkey"), err
 	}
 	subkey := entity.Subkeys[len(entity.Subkeys)-1]
 
-	var buf bytes.Buffer
-	err = entity.SerializePrivate(&buf, nil)
-	if err != nil {
-		return nil, err
-	}
-	currStorageEntry, err := logical.StorageEntryJSON("key/"+name, &keyEntry{
-		SerializedKey: buf.Bytes(),
-		Exportable:    exportable,
-	})
-	if err != nil {
-		return nil, err
-	}
-	if err := req.Storage.Put(ctx, currStorageEntry); err != nil {
+	if err := b.setEntity(ctx, req.Storage, name, entry, entity); err != nil {
 		return nil, err
 	}
 
@@ -144,44 +179,92 @@ func (b *backend) pathSubkeyCreate(ctx context.Context, req *logical.Request, da
 }
 
 func (b *backend) pathSubkeyDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Whoever already has the public key would keep trusting a subkey that
+	// silently disappeared from it, so subkeys can only be revoked.
+	return logical.ErrorResponse("subkeys cannot be deleted, revoke them instead"), nil
+}
+
+func (b *backend) pathSubkeyRevoke(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	name := data.Get("name").(string)
-	fingerprintHex := data.Get("key_id").(string)
+	keyID := data.Get("key_id").(string)
+	reason, err := revocationReason(data.Get("reason_code").(int))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	reasonText := data.Get("reason_text").(string)
+
+	lock := locksutil.LockForKey(b.keyLocks, name)
+	lock.Lock()
+	defer lock.Unlock()
 
-	entity, exportable, err := b.readEntity(ctx, req.Storage, name)
+	entry, err := b.key(ctx, req.Storage, name)
 	if err != nil {
 		return nil, err
 	}
-	if entity == nil {
+	if entry == nil {
 		return logical.ErrorResponse("master key does not exist"), nil
 	}
-
-	subkeys := []openpgp.Subkey{}
-	for _, subkey := range entity.Subkeys {
-		if subkey.PublicKey.KeyIdString() != fingerprintHex {
-			subkeys = append(subkeys, subkey)
-		}
-	}
-	entity.Subkeys = subkeys
-
-	var buf bytes.Buffer
-	err = entity.SerializePrivate(&buf, nil)
+	entity, err := b.entity(entry)
 	if err != nil {
 		return nil, err
 	}
-	currStorageEntry, err := logical.StorageEntryJSON("key/"+name, &keyEntry{
-		SerializedKey: buf.Bytes(),
-		Exportable:    exportable,
-	})
+	if entity == nil {
+		return logical.ErrorResponse("master key does not exist"), nil
+	}
+
+	subkey, err := findSubkey(entity, keyID)
 	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if subkey == nil {
+		return logical.ErrorResponse("subkey does not exist"), nil
+	}
+	if subkey.Sig.SigType == packet.SigTypeSubkeyRevocation {
+		return logical.ErrorResponse("subkey is already revoked"), nil
+	}
+
+	if err := revokeSubkey(entity, subkey, reason, reasonText, &packet.Config{}); err != nil {
 		return nil, err
 	}
-	if err := req.Storage.Put(ctx, currStorageEntry); err != nil {
+	if err := b.setEntity(ctx, req.Storage, name, entry, entity); err != nil {
 		return nil, err
 	}
+	return nil, nil
+}
 
+// findSubkey returns the subkey of the entity with the given hex-encoded Key
+// ID, or nil if there is none.
+func findSubkey(entity *openpgp.Entity, keyIDHex string) (*openpgp.Subkey, error) {
+	keyID, err := hex.DecodeString(keyIDHex)
+	if err != nil || len(keyID) != 8 {
+		return nil, fmt.Errorf("could not hex decode KeyID %s", keyIDHex)
+	}
+	for i := range entity.Subkeys {
+		if entity.Subkeys[i].PublicKey.KeyId == binary.BigEndian.Uint64(keyID) {
+			return &entity.Subkeys[i], nil
+		}
+	}
 	return nil, nil
 }
 
+// subkeyRevocation returns the revocation status of a subkey.
+func subkeyRevocation(subkey openpgp.Subkey) map[string]interface{} {
+	if subkey.Sig.SigType != packet.SigTypeSubkeyRevocation {
+		return map[string]interface{}{
+			"revoked": false,
+		}
+	}
+	reasonCode := 0
+	if subkey.Sig.RevocationReason != nil {
+		reasonCode = int(*subkey.Sig.RevocationReason)
+	}
+	return map[string]interface{}{
+		"revoked":                true,
+		"revocation_reason_code": reasonCode,
+		"revocation_reason_text": subkey.Sig.RevocationReasonText,
+	}
+}
+
 func (b *backend) pathSubkeyList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	name := data.Get("name").(string)
 
@@ -194,72 +277,93 @@ func (b *backend) pathSubkeyList(ctx context.Context, req *logical.Request, data
 	}
 
 	keyIDs := []string{}
+	keyInfo := make(map[string]interface{})
 	for _, subkey := range entity.Subkeys {
 		keyIDs = append(keyIDs, subkey.PublicKey.KeyIdString())
+		keyInfo[subkey.PublicKey.KeyIdString()] = subkeyRevocation(subkey)
 	}
 
-	return logical.ListResponse(keyIDs), nil
+	return logical.ListResponseWithInfo(keyIDs, keyInfo), nil
 }
 
 func (b *backend) pathSubkeyRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	name := data.Get("name").(string)
-	fingerprintHex := data.Get("key_id").(string)
-	fingerprint, err := hex.DecodeString(fingerprintHex)
+	keyID := data.Get("key_id").(string)
+
+	entry, err := b.key(ctx, req.Storage, name)
 	if err != nil {
-		return logical.ErrorResponse("could not hex decode KeyID %s", fingerprintHex), err
+		return nil, err
 	}
-	keyID := binary.BigEndian.Uint64(fingerprint)
-
-	keyRing, _, err := b.readKeyRing(ctx, req.Storage, name)
+	if entry == nil {
+		return logical.ErrorResponse("master key does not exist"), nil
+	}
+	entity, err := b.entity(entry)
 	if err != nil {
 		return nil, err
 	}
-	if keyRing == nil || len(keyRing) == 0 {
+	if entity == nil {
 		return logical.ErrorResponse("master key does not exist"), nil
 	}
 
-	subkeys := keyRing.KeysById(keyID)
-	if len(subkeys) != 1 {
-		return logical.ErrorResponse("there are %v != 1 subkeys", len(subkeys)), nil
+	subkey, err := findSubkey(entity, keyID)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
 	}
-	subkey := subkeys[0]
-	if !subkey.PrivateKey.IsSubkey || !subkey.PublicKey.IsSubkey {
-		return logical.ErrorResponse("KeyID %v does not correspond to a subkey", keyID), nil
+	if subkey == nil {
+		return logical.ErrorResponse("KeyID %s does not correspond to a subkey", keyID), nil
 	}
 
-	var keyType string
-	var keyBits uint16
-	switch subkey.PublicKey.PubKeyAlgo {
-	case packet.PubKeyAlgoRSA:
-		keyType = "rsa"
-		keyBits, err = subkey.PublicKey.BitLength()
-		if err != nil {
-			return nil, err
-		}
-	default:
+	if _, err := publicKeyType(subkey.PublicKey); err != nil {
 		return logical.ErrorResponse("unknown subkey type: %v", subkey.PublicKey.PubKeyAlgo), nil
 	}
+	bindings, err := subkeyBindings(entry.SerializedKey)
+	if err != nil {
+		return nil, err
+	}
+	info, err := subkeyInfo(*subkey, bindings)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: info,
+	}, nil
+}
 
-	capabilities := []string{}
-	if subkey.SelfSignature.FlagsValid {
-		if subkey.SelfSignature.FlagSign {
-			capabilities = append(capabilities, "sign")
-		}
-		if subkey.SelfSignature.FlagEncryptCommunications || subkey.SelfSignature.FlagEncryptStorage {
-			capabilities = append(capabilities, "encrypt")
+// subkeyInfo describes a subkey. The capabilities and expiry of a revoked
+// subkey are taken from its binding signature in bindings.
+func subkeyInfo(subkey openpgp.Subkey, bindings map[uint64]*packet.Signature) (map[string]interface{}, error) {
+	selfSignature := subkey.Sig
+	if selfSignature.SigType == packet.SigTypeSubkeyRevocation {
+		selfSignature = bindings[subkey.PublicKey.KeyId]
+		if selfSignature == nil {
+			return nil, fmt.Errorf("no binding signature found for revoked subkey %s", subkey.PublicKey.KeyIdString())
 		}
 	}
+
+	keyBits, err := publicKeyBits(subkey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
 	expires := uint32(0)
-	if subkey.SelfSignature.KeyLifetimeSecs != nil {
-		expires = *subkey.SelfSignature.KeyLifetimeSecs
+	expirationTime := ""
+	if selfSignature.KeyLifetimeSecs != nil && *selfSignature.KeyLifetimeSecs > 0 {
+		expires = *selfSignature.KeyLifetimeSecs
+		expirationTime = formatTime(subkey.PublicKey.CreationTime.Add(time.Duration(expires) * time.Second))
 	}
 
-	return &logical.Response{
-		Data: map[string]interface{}{
-			"key_type":     keyType,
-			"capabilities": capabilities,
-			"key_bits":     keyBits,
-			"expires":      expires,
-		},
-	}, nil
+	info := map[string]interface{}{
+		"key_id":          subkey.PublicKey.KeyIdString(),
+		"fingerprint":     hex.EncodeToString(subkey.PublicKey.Fingerprint[:]),
+		"key_type":        keyTypeName(subkey.PublicKey),
+		"capabilities":    keyCapabilities(selfSignature),
+		"key_bits":        keyBits,
+		"curve":           publicKeyCurve(subkey.PublicKey),
+		"creation_time":   formatTime(subkey.PublicKey.CreationTime),
+		"expiration_time": expirationTime,
+		"expires":         expires,
+	}
+	for k, v := range subkeyRevocation(subkey) {
+		info[k] = v
+	}
+	return info, nil
 }
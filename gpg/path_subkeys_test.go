@@ -0,0 +1,217 @@
+package gpg
+
+import (
+	"context"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func TestGPG_SubkeyCapabilities(t *testing.T) {
+	for _, keyType := range []string{"rsa", "ed25519", "ecdsa-p256"} {
+		t.Run(keyType, func(t *testing.T) {
+			storage := &logical.InmemStorage{}
+			b := Backend()
+
+			request := newTestRequest(t, b, storage)
+
+			request(logical.UpdateOperation, "keys/test", map[string]interface{}{
+				"real_name": "Vault GPG test",
+				"key_type":  keyType,
+			})
+
+			cases := [][]string{
+				{"sign"},
+				{"encrypt"},
+				{"authenticate"},
+				{"sign", "authenticate"},
+			}
+			if keyType == "rsa" {
+				cases = append(cases, []string{"sign", "encrypt", "authenticate"})
+			}
+			for _, capabilities := range cases {
+				keyID := request(logical.UpdateOperation, "keys/test/subkeys", map[string]interface{}{
+					"key_type":     keyType,
+					"key_bits":     2048,
+					"capabilities": capabilities,
+				}).Data["key_id"].(string)
+				actual := request(logical.ReadOperation, "keys/test/subkeys/"+keyID, nil).Data["capabilities"]
+				if !reflect.DeepEqual(actual, capabilities) {
+					t.Errorf("expected capabilities %v, got %v", capabilities, actual)
+				}
+			}
+
+			// The newest encryption subkey is used for encryption
+			plaintext := "QWxwYWNhcwo="
+			ciphertext := request(logical.UpdateOperation, "encrypt/test", map[string]interface{}{
+				"plaintext": plaintext,
+			}).Data["ciphertext"]
+			resp := request(logical.UpdateOperation, "decrypt/test", map[string]interface{}{
+				"ciphertext": ciphertext,
+			})
+			if resp.Data["plaintext"] != plaintext {
+				t.Fatalf("expected plaintext %s, got: %s", plaintext, resp.Data["plaintext"])
+			}
+		})
+	}
+}
+
+func TestGPG_SubkeyCapabilitiesError(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/test",
+		Data: map[string]interface{}{
+			"real_name": "Vault GPG test",
+			"key_type":  "ed25519",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	createSubkeyMustFail := func(keyType string, capabilities []string) {
+		resp, _ := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      "keys/test/subkeys",
+			Data: map[string]interface{}{
+				"key_type":     keyType,
+				"capabilities": capabilities,
+			},
+		})
+		if !resp.IsError() {
+			t.Fatalf("expected to fail, key type: %s, capabilities: %v", keyType, capabilities)
+		}
+	}
+
+	createSubkeyMustFail("ed25519", []string{"certify"})
+	createSubkeyMustFail("ed25519", []string{"sign", "sign"})
+	createSubkeyMustFail("ed25519", []string{"sign", "encrypt"})
+	createSubkeyMustFail("ecdsa-p256", []string{"encrypt", "authenticate"})
+	createSubkeyMustFail("dsa", []string{"sign"})
+}
+
+func TestGPG_RevokeSubkey(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	request := newTestRequest(t, b, storage)
+
+	request(logical.UpdateOperation, "keys/test", map[string]interface{}{
+		"real_name": "Vault GPG test",
+		"key_type":  "ed25519",
+	})
+	keyID := request(logical.UpdateOperation, "keys/test/subkeys", map[string]interface{}{
+		"key_type": "ed25519",
+	}).Data["key_id"].(string)
+
+	// Key IDs are matched regardless of their case
+	request(logical.UpdateOperation, "keys/test/subkeys/"+strings.ToLower(keyID)+"/revoke", map[string]interface{}{
+		"reason_code": 1,
+		"reason_text": "Superseded",
+	})
+	// Further changes keep the binding signature of the revoked subkey
+	request(logical.UpdateOperation, "keys/test/subkeys", map[string]interface{}{
+		"key_type": "ed25519",
+	})
+
+	resp := request(logical.ReadOperation, "keys/test/subkeys/"+keyID, nil)
+	if resp.Data["revoked"] != true || resp.Data["revocation_reason_code"] != 1 || resp.Data["revocation_reason_text"] != "Superseded" {
+		t.Fatalf("unexpected revocation status: %#v", resp.Data)
+	}
+	if capabilities := resp.Data["capabilities"].([]string); !reflect.DeepEqual(capabilities, []string{"sign"}) {
+		t.Fatalf("expected capabilities [sign], got %v", capabilities)
+	}
+
+	resp = request(logical.ListOperation, "keys/test/subkeys", nil)
+	if len(resp.Data["keys"].([]string)) != 3 {
+		t.Fatalf("expected 3 subkeys, got %v", resp.Data["keys"])
+	}
+	keyInfo := resp.Data["key_info"].(map[string]interface{})
+	if keyInfo[keyID].(map[string]interface{})["revoked"] != true {
+		t.Fatalf("expected subkey %s to be listed as revoked: %#v", keyID, keyInfo)
+	}
+
+	// The revoked subkey stays in the public key, with both signatures
+	publicKey := request(logical.ReadOperation, "keys/test", nil).Data["public_key"].(string)
+	el, err := openpgp.ReadArmoredKeyRing(strings.NewReader(publicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var revokedSubkey *openpgp.Subkey
+	for i, subkey := range el[0].Subkeys {
+		if subkey.PublicKey.KeyIdString() == keyID && subkey.Sig.SigType == packet.SigTypeSubkeyRevocation {
+			revokedSubkey = &el[0].Subkeys[i]
+		}
+	}
+	if revokedSubkey == nil {
+		t.Fatalf("expected revoked subkey %s in the public key", keyID)
+	}
+	block, err := armor.Decode(strings.NewReader(publicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serializedKey, err := ioutil.ReadAll(block.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bindings, err := subkeyBindings(serializedKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bindings[revokedSubkey.PublicKey.KeyId]; !ok {
+		t.Fatal("expected the binding signature of the revoked subkey in the public key")
+	}
+
+	// The revoked subkey is not used to sign anymore
+	input := "QWxwYWNhcwo="
+	signature := request(logical.UpdateOperation, "sign/test", map[string]interface{}{
+		"input": input,
+	}).Data["signature"]
+	resp = request(logical.UpdateOperation, "verify/test", map[string]interface{}{
+		"input":     input,
+		"signature": signature,
+	})
+	if resp.Data["valid"] != true {
+		t.Fatalf("expected signature to be valid: %v", resp.Data["error"])
+	}
+
+	for _, path := range []string{"keys/test/subkeys/" + keyID + "/revoke", "keys/test/subkeys/0000000000000000/revoke", "keys/test/subkeys/ABCD/revoke", "keys/test/subkeys/notHex/revoke", "keys/doNotExist/subkeys/" + keyID + "/revoke"} {
+		resp, _ := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      path,
+		})
+		if !resp.IsError() {
+			t.Fatalf("expected %s to fail", path)
+		}
+	}
+	for _, keyID := range []string{"0000000000000000", "abcd", "notHex"} {
+		if resp := testHandleRequest(t, b, storage, logical.ReadOperation, "keys/test/subkeys/"+keyID, nil); !resp.IsError() {
+			t.Fatalf("expected reading subkey %s to fail", keyID)
+		}
+	}
+
+	// Subkeys cannot be deleted, only revoked
+	resp, _ = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.DeleteOperation,
+		Path:      "keys/test/subkeys/" + keyID,
+	})
+	if !resp.IsError() {
+		t.Fatal("expected subkey deletion to fail")
+	}
+	if keys := request(logical.ListOperation, "keys/test/subkeys", nil).Data["keys"].([]string); len(keys) != 3 {
+		t.Fatalf("expected 3 subkeys, got %v", keys)
+	}
+}
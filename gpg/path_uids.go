@@ -0,0 +1,387 @@
+package gpg
+
+import (
+	"context"
+	"sort"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func pathUIDs(b *backend) *framework.Path {
+	return &framework.Path{
+		// The "/?" is there at the end to handle libraries that may add it.
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/uids/?$",
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the key.",
+			},
+			"real_name": {
+				Type:        framework.TypeString,
+				Description: "The real name of the user ID to add. Must not contain any of \"()<>\x00\".",
+			},
+			"email": {
+				Type:        framework.TypeString,
+				Description: "The email of the user ID to add. Must not contain any of \"()<>\x00\".",
+			},
+			"comment": {
+				Type:        framework.TypeString,
+				Description: "The comment of the user ID to add. Must not contain any of \"()<>\x00\".",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ListOperation: &framework.PathOperation{
+				Callback: b.pathUIDList,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathUIDCreate,
+			},
+		},
+		HelpSynopsis:    pathUIDsHelpSyn,
+		HelpDescription: pathUIDsHelpDesc,
+	}
+}
+
+func pathUIDRevoke(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/uids/revoke",
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the key.",
+			},
+			"uid": {
+				Type:        framework.TypeString,
+				Description: "The user ID to revoke, as returned by the list operation.",
+			},
+			"reason_code": {
+				Type:        framework.TypeInt,
+				Default:     0,
+				Description: "The reason for revocation. Can be 0 (no reason specified) or 32 (user ID is no longer valid). Defaults to 0.",
+			},
+			"reason_text": {
+				Type:        framework.TypeString,
+				Description: "A human-readable explanation of the revocation.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathUIDRevoke,
+			},
+		},
+		HelpSynopsis:    pathUIDRevokeHelpSyn,
+		HelpDescription: pathUIDRevokeHelpDesc,
+	}
+}
+
+func pathUIDPrimary(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/uids/primary",
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the key.",
+			},
+			"uid": {
+				Type:        framework.TypeString,
+				Description: "The user ID to mark as primary, as returned by the list operation.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathUIDPrimary,
+			},
+		},
+		HelpSynopsis:    pathUIDPrimaryHelpSyn,
+		HelpDescription: pathUIDPrimaryHelpDesc,
+	}
+}
+
+func (b *backend) pathUIDList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	entity, _, err := b.readEntity(ctx, req.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil {
+		return logical.ErrorResponse("master key does not exist"), nil
+	}
+
+	uids := []string{}
+	keyInfo := make(map[string]interface{})
+	for _, identity := range identities(entity) {
+		uid := identity["uid"].(string)
+		uids = append(uids, uid)
+		keyInfo[uid] = identity
+	}
+	return logical.ListResponseWithInfo(uids, keyInfo), nil
+}
+
+func (b *backend) pathUIDCreate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	uid := packet.NewUserId(data.Get("real_name").(string), data.Get("comment").(string), data.Get("email").(string))
+	if uid == nil {
+		return logical.ErrorResponse("invalid user ID, the real name, email and comment must not contain any of \"()<>\\x00\""), nil
+	}
+	if uid.Id == "" {
+		return logical.ErrorResponse("the user ID cannot be empty"), nil
+	}
+
+	lock := locksutil.LockForKey(b.keyLocks, name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	entry, entity, resp, err := b.writableEntity(ctx, req.Storage, name)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+	if _, ok := entity.Identities[uid.Id]; ok {
+		return logical.ErrorResponse("user ID %s already exists", uid.Id), nil
+	}
+
+	identity := &openpgp.Identity{
+		Name:   uid.Id,
+		UserId: uid,
+	}
+	err = signIdentity(entity, identity, entity.PrimaryIdentity().SelfSignature, false, &packet.Config{})
+	if err != nil {
+		return nil, err
+	}
+	entity.Identities[uid.Id] = identity
+
+	if err := b.setEntity(ctx, req.Storage, name, entry, entity); err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"uid": uid.Id,
+		},
+	}, nil
+}
+
+func (b *backend) pathUIDRevoke(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	uid := data.Get("uid").(string)
+	reasonCode := data.Get("reason_code").(int)
+	if reasonCode != int(packet.NoReason) && reasonCode != reasonUserIDInvalid {
+		return logical.ErrorResponse("unsupported reason code %d; must be 0 or 32", reasonCode), nil
+	}
+
+	lock := locksutil.LockForKey(b.keyLocks, name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	entry, entity, resp, err := b.writableEntity(ctx, req.Storage, name)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+	identity, ok := entity.Identities[uid]
+	if !ok {
+		return logical.ErrorResponse("user ID %s does not exist", uid), nil
+	}
+	if identityRevocation(entity, identity) != nil {
+		return logical.ErrorResponse("user ID %s is already revoked", uid), nil
+	}
+	if identity == entity.PrimaryIdentity() {
+		return logical.ErrorResponse("cannot revoke the primary user ID, mark another user ID as primary first"), nil
+	}
+
+	config := &packet.Config{}
+	reason := uint8(reasonCode)
+	sig := &packet.Signature{
+		Version:              entity.PrimaryKey.Version,
+		CreationTime:         config.Now(),
+		SigType:              sigTypeCertificationRevocation,
+		PubKeyAlgo:           entity.PrimaryKey.PubKeyAlgo,
+		Hash:                 signatureHash(config.Hash(), entity.PrimaryKey),
+		RevocationReason:     &reason,
+		RevocationReasonText: data.Get("reason_text").(string),
+		IssuerKeyId:          &entity.PrimaryKey.KeyId,
+	}
+	if err := sig.SignUserId(uid, entity.PrimaryKey, entity.PrivateKey, config); err != nil {
+		return nil, err
+	}
+	identity.Signatures = append(identity.Signatures, sig)
+
+	if err := b.setEntity(ctx, req.Storage, name, entry, entity); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) pathUIDPrimary(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	uid := data.Get("uid").(string)
+
+	lock := locksutil.LockForKey(b.keyLocks, name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	entry, entity, resp, err := b.writableEntity(ctx, req.Storage, name)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+	primary, ok := entity.Identities[uid]
+	if !ok {
+		return logical.ErrorResponse("user ID %s does not exist", uid), nil
+	}
+	if identityRevocation(entity, primary) != nil {
+		return logical.ErrorResponse("user ID %s is revoked", uid), nil
+	}
+
+	// Only one user ID can be flagged as primary
+	config := &packet.Config{}
+	for _, identity := range entity.Identities {
+		isPrimary := identity.SelfSignature.IsPrimaryId != nil && *identity.SelfSignature.IsPrimaryId
+		if identity == primary && !isPrimary || identity != primary && isPrimary {
+			if err := signIdentity(entity, identity, identity.SelfSignature, identity == primary, config); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := b.setEntity(ctx, req.Storage, name, entry, entity); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// writableEntity reads the latest version of a key that is about to be
+// modified. It returns an error response if the key does not exist or is
+// revoked.
+func (b *backend) writableEntity(ctx context.Context, s logical.Storage, name string) (*keyEntry, *openpgp.Entity, *logical.Response, error) {
+	entry, err := b.key(ctx, s, name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if entry == nil {
+		return nil, nil, logical.ErrorResponse("master key does not exist"), nil
+	}
+	entity, err := b.entity(entry)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if entity == nil {
+		return nil, nil, logical.ErrorResponse("master key does not exist"), nil
+	}
+	if len(entity.Revocations) > 0 {
+		return nil, nil, logical.ErrorResponse("master key is revoked"), nil
+	}
+	return entry, entity, nil, nil
+}
+
+// signIdentity creates a new self-signature of the identity, with the same
+// key flags, key expiration and preferences as template. It replaces all the
+// previous self-signatures of the identity, if any.
+func signIdentity(e *openpgp.Entity, identity *openpgp.Identity, template *packet.Signature, primary bool, config *packet.Config) error {
+	sig := &packet.Signature{
+		Version:                   e.PrimaryKey.Version,
+		CreationTime:              config.Now(),
+		SigType:                   packet.SigTypePositiveCert,
+		PubKeyAlgo:                e.PrimaryKey.PubKeyAlgo,
+		Hash:                      signatureHash(config.Hash(), e.PrimaryKey),
+		IsPrimaryId:               &primary,
+		FlagsValid:                template.FlagsValid,
+		FlagCertify:               template.FlagCertify,
+		FlagSign:                  template.FlagSign,
+		FlagEncryptCommunications: template.FlagEncryptCommunications,
+		FlagEncryptStorage:        template.FlagEncryptStorage,
+		KeyLifetimeSecs:           template.KeyLifetimeSecs,
+		PreferredSymmetric:        template.PreferredSymmetric,
+		PreferredHash:             template.PreferredHash,
+		PreferredCompression:      template.PreferredCompression,
+		PreferredAEAD:             template.PreferredAEAD,
+		MDC:                       template.MDC,
+		AEAD:                      template.AEAD,
+		V5Keys:                    template.V5Keys,
+		IssuerKeyId:               &e.PrimaryKey.KeyId,
+	}
+	if err := sig.SignUserId(identity.Name, e.PrimaryKey, e.PrivateKey, config); err != nil {
+		return err
+	}
+
+	// The previous self-signatures are superseded, but the revocations and
+	// the certifications made by other keys are kept
+	signatures := []*packet.Signature{}
+	for _, s := range identity.Signatures {
+		if s != identity.SelfSignature && !isSelfCertification(e, s) {
+			signatures = append(signatures, s)
+		}
+	}
+	identity.Signatures = append(signatures, sig)
+	identity.SelfSignature = sig
+	return nil
+}
+
+// isSelfCertification returns whether the signature is a certification of a
+// user ID made by the primary key of the entity.
+func isSelfCertification(e *openpgp.Entity, sig *packet.Signature) bool {
+	for _, sigType := range certificationTypes {
+		if sig.SigType == sigType {
+			return sig.CheckKeyIdOrFingerprint(e.PrimaryKey)
+		}
+	}
+	return false
+}
+
+// identityRevocation returns the revocation signature of a user ID made by
+// the primary key, if any.
+func identityRevocation(e *openpgp.Entity, identity *openpgp.Identity) *packet.Signature {
+	for _, sig := range identity.Signatures {
+		if sig.SigType == sigTypeCertificationRevocation && e.PrimaryKey.VerifyUserIdSignature(identity.Name, e.PrimaryKey, sig) == nil {
+			return sig
+		}
+	}
+	return nil
+}
+
+// identities describes the user IDs of the entity, sorted by user ID.
+func identities(e *openpgp.Entity) []map[string]interface{} {
+	primary := e.PrimaryIdentity()
+	result := []map[string]interface{}{}
+	for _, identity := range e.Identities {
+		info := map[string]interface{}{
+			"uid":     identity.Name,
+			"name":    identity.UserId.Name,
+			"email":   identity.UserId.Email,
+			"comment": identity.UserId.Comment,
+			"primary": identity == primary,
+			"revoked": false,
+		}
+		if revocation := identityRevocation(e, identity); revocation != nil {
+			reasonCode := 0
+			if revocation.RevocationReason != nil {
+				reasonCode = int(*revocation.RevocationReason)
+			}
+			info["revoked"] = true
+			info["revocation_reason_code"] = reasonCode
+			info["revocation_reason_text"] = revocation.RevocationReasonText
+		}
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i]["uid"].(string) < result[j]["uid"].(string)
+	})
+	return result
+}
+
+const pathUIDsHelpSyn = "Add and list the user IDs of a named GPG key"
+const pathUIDsHelpDesc = `
+This path is used to add user IDs to the latest version of the named GPG key,
+and to list them. New user IDs are self-signed by the key.
+`
+
+const pathUIDRevokeHelpSyn = "Revoke a user ID of a named GPG key"
+const pathUIDRevokeHelpDesc = `
+This path is used to revoke a user ID of the latest version of the named GPG
+key. The primary user ID cannot be revoked.
+`
+
+const pathUIDPrimaryHelpSyn = "Mark a user ID of a named GPG key as primary"
+const pathUIDPrimaryHelpDesc = `
+This path is used to mark a user ID of the latest version of the named GPG key
+as the primary user ID.
+`
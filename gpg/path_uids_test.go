@@ -0,0 +1,184 @@
+package gpg
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func TestGPG_UIDs(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	request := newTestRequest(t, b, storage)
+
+	request(logical.UpdateOperation, "keys/test", map[string]interface{}{
+		"real_name": "Vault GPG test",
+		"email":     "vault@example.com",
+		"key_type":  "ecdsa-p256",
+	})
+	resp := request(logical.UpdateOperation, "keys/test/uids", map[string]interface{}{
+		"real_name": "Vault GPG test",
+		"email":     "vault@example.org",
+		"comment":   "New",
+	})
+	newUID := "Vault GPG test (New) <vault@example.org>"
+	if resp.Data["uid"] != newUID {
+		t.Fatalf("expected user ID %s, got %v", newUID, resp.Data["uid"])
+	}
+	oldUID := "Vault GPG test <vault@example.com>"
+
+	primaryUID := func() string {
+		var primary string
+		keyInfo := request(logical.ListOperation, "keys/test/uids", nil).Data["key_info"].(map[string]interface{})
+		for uid, info := range keyInfo {
+			if info.(map[string]interface{})["primary"] == true {
+				primary = uid
+			}
+		}
+		return primary
+	}
+
+	resp = request(logical.ListOperation, "keys/test/uids", nil)
+	if uids := resp.Data["keys"].([]string); !reflect.DeepEqual(uids, []string{newUID, oldUID}) {
+		t.Fatalf("unexpected user IDs: %v", uids)
+	}
+	if primary := primaryUID(); primary != oldUID {
+		t.Fatalf("expected primary user ID %s, got %s", oldUID, primary)
+	}
+
+	request(logical.UpdateOperation, "keys/test/uids/primary", map[string]interface{}{
+		"uid": newUID,
+	})
+	if primary := primaryUID(); primary != newUID {
+		t.Fatalf("expected primary user ID %s, got %s", newUID, primary)
+	}
+
+	request(logical.UpdateOperation, "keys/test/uids/revoke", map[string]interface{}{
+		"uid":         oldUID,
+		"reason_code": 32,
+		"reason_text": "Moved",
+	})
+
+	// Reads of the key report the identities, and the public key contains them
+	resp = request(logical.ReadOperation, "keys/test", nil)
+	identities := resp.Data["identities"].([]map[string]interface{})
+	if len(identities) != 2 {
+		t.Fatalf("expected 2 identities, got %v", identities)
+	}
+	revoked := identities[1]
+	if revoked["uid"] != oldUID || revoked["revoked"] != true || revoked["revocation_reason_code"] != 32 || revoked["revocation_reason_text"] != "Moved" {
+		t.Fatalf("unexpected revoked identity: %#v", revoked)
+	}
+	if identities[0]["email"] != "vault@example.org" || identities[0]["comment"] != "New" || identities[0]["primary"] != true {
+		t.Fatalf("unexpected new identity: %#v", identities[0])
+	}
+	el, err := openpgp.ReadArmoredKeyRing(strings.NewReader(resp.Data["public_key"].(string)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(el[0].Identities) != 2 || el[0].PrimaryIdentity().Name != newUID {
+		t.Fatalf("unexpected identities in public key: %v", el[0].Identities)
+	}
+
+	// The key is still usable
+	input := "QWxwYWNhcwo="
+	signature := request(logical.UpdateOperation, "sign/test", map[string]interface{}{
+		"input": input,
+	}).Data["signature"]
+	resp = request(logical.UpdateOperation, "verify/test", map[string]interface{}{
+		"input":     input,
+		"signature": signature,
+	})
+	if resp.Data["valid"] != true {
+		t.Fatalf("expected signature to be valid: %v", resp.Data["error"])
+	}
+}
+
+func TestGPG_UIDsError(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/test",
+		Data: map[string]interface{}{
+			"real_name": "Vault GPG test",
+			"key_type":  "ed25519",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/test/uids",
+		Data: map[string]interface{}{
+			"real_name": "Other",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requestMustFail := func(path string, data map[string]interface{}) {
+		resp, _ := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+		})
+		if !resp.IsError() {
+			t.Fatalf("expected to fail, path: %s, data: %v", path, data)
+		}
+	}
+
+	requestMustFail("keys/doNotExist/uids", map[string]interface{}{"real_name": "Vault"})
+	requestMustFail("keys/test/uids", map[string]interface{}{"real_name": "Vault<>"})
+	requestMustFail("keys/test/uids", map[string]interface{}{})
+	requestMustFail("keys/test/uids", map[string]interface{}{"real_name": "Other"})
+	requestMustFail("keys/test/uids/revoke", map[string]interface{}{"uid": "Vault GPG test"})
+	requestMustFail("keys/test/uids/revoke", map[string]interface{}{"uid": "Other", "reason_code": 1})
+	requestMustFail("keys/test/uids/revoke", map[string]interface{}{"uid": "Unknown"})
+	requestMustFail("keys/test/uids/primary", map[string]interface{}{"uid": "Unknown"})
+}
+
+func TestGPG_SignIdentity(t *testing.T) {
+	entity, err := openpgp.NewEntity("Vault GPG test", "", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certifier, err := openpgp.NewEntity("Vault GPG CA", "", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity := entity.PrimaryIdentity()
+
+	// An older self-signature, as kept by the openpgp library when reading a
+	// key, and a certification by another key
+	older := *identity.SelfSignature
+	older.CreationTime = older.CreationTime.Add(-time.Hour)
+	if err := older.SignUserId(identity.Name, entity.PrimaryKey, entity.PrivateKey, nil); err != nil {
+		t.Fatal(err)
+	}
+	identity.Signatures = append([]*packet.Signature{&older}, identity.Signatures...)
+	if err := entity.SignIdentity(identity.Name, certifier, nil); err != nil {
+		t.Fatal(err)
+	}
+	certification := identity.Signatures[2]
+
+	if err := signIdentity(entity, identity, identity.SelfSignature, true, &packet.Config{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(identity.Signatures) != 2 || identity.Signatures[0] != certification || identity.Signatures[1] != identity.SelfSignature {
+		t.Fatalf("expected the certification and the new self-signature, got %d signatures", len(identity.Signatures))
+	}
+}
@@ -0,0 +1,385 @@
+package gpg
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"time"
+
+	"golang.org/x/crypto/openpgp/packet"
+	"golang.org/x/crypto/openpgp/s2k"
+)
+
+// Signature subpacket types, see RFC 4880, section 5.2.3.1.
+const (
+	subpacketCreationTime      = 2
+	subpacketKeyExpiration     = 9
+	subpacketIssuer            = 16
+	subpacketNotationData      = 20
+	subpacketKeyFlags          = 27
+	subpacketEmbeddedSignature = 32
+	subpacketIssuerFingerprint = 33
+	subpacketTypeMask          = 0x7f
+)
+
+const (
+	sigTypeCertificationRevocation packet.SignatureType = 0x30
+	reasonUserIDInvalid                                 = 32
+)
+
+const (
+	keyFlagAuthenticate    = 0x20
+	signaturePacketTag     = 2
+	signaturePacketVersion = 4
+	newFormatPacketHeader  = 0xc0
+)
+
+// subpacket is a raw signature subpacket.
+type subpacket struct {
+	typ      uint8
+	contents []byte
+}
+
+// serializeSubpackets writes the given subpackets in the format of the
+// subpacket area of a signature, without the area length.
+func serializeSubpackets(subpackets []subpacket) []byte {
+	var buf bytes.Buffer
+	for _, sp := range subpackets {
+		length := len(sp.contents) + 1
+		switch {
+		case length < 192:
+			buf.WriteByte(byte(length))
+		case length < 16320:
+			length -= 192
+			buf.WriteByte(byte(length>>8) + 192)
+			buf.WriteByte(byte(length))
+		default:
+			buf.WriteByte(255)
+			_ = binary.Write(&buf, binary.BigEndian, uint32(length))
+		}
+		buf.WriteByte(sp.typ)
+		buf.Write(sp.contents)
+	}
+	return buf.Bytes()
+}
+
+// parseSubpackets parses the subpacket area of a signature, without the area
+// length.
+func parseSubpackets(area []byte) ([]subpacket, error) {
+	var subpackets []subpacket
+	for len(area) > 0 {
+		var length int
+		switch {
+		case area[0] < 192:
+			length = int(area[0])
+			area = area[1:]
+		case area[0] < 255:
+			if len(area) < 2 {
+				return nil, fmt.Errorf("signature subpacket truncated")
+			}
+			length = (int(area[0])-192)<<8 + int(area[1]) + 192
+			area = area[2:]
+		default:
+			if len(area) < 5 {
+				return nil, fmt.Errorf("signature subpacket truncated")
+			}
+			length = int(binary.BigEndian.Uint32(area[1:5]))
+			area = area[5:]
+		}
+		if length < 1 || length > len(area) {
+			return nil, fmt.Errorf("signature subpacket truncated")
+		}
+		subpackets = append(subpackets, subpacket{
+			typ:      area[0] & subpacketTypeMask,
+			contents: area[1:length],
+		})
+		area = area[length:]
+	}
+	return subpackets, nil
+}
+
+// signatureSubpackets returns the hashed and unhashed subpackets of a v4
+// signature. The openpgp library only exposes the subpackets it knows about.
+func signatureSubpackets(sig *packet.Signature) (hashed, unhashed []subpacket, err error) {
+	var buf bytes.Buffer
+	if err = sig.Serialize(&buf); err != nil {
+		return nil, nil, err
+	}
+	body, err := packetBody(buf.Bytes())
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(body) < 6 || body[0] != signaturePacketVersion {
+		return nil, nil, fmt.Errorf("unsupported signature packet version")
+	}
+	hashedLength := int(binary.BigEndian.Uint16(body[4:6]))
+	if len(body) < 8+hashedLength {
+		return nil, nil, fmt.Errorf("signature packet truncated")
+	}
+	unhashedLength := int(binary.BigEndian.Uint16(body[6+hashedLength : 8+hashedLength]))
+	if len(body) < 8+hashedLength+unhashedLength {
+		return nil, nil, fmt.Errorf("signature packet truncated")
+	}
+	if hashed, err = parseSubpackets(body[6 : 6+hashedLength]); err != nil {
+		return nil, nil, err
+	}
+	if unhashed, err = parseSubpackets(body[8+hashedLength : 8+hashedLength+unhashedLength]); err != nil {
+		return nil, nil, err
+	}
+	return hashed, unhashed, nil
+}
+
+// keyFlags returns the raw key flags of a signature, including those the
+// openpgp library does not know about, such as the authentication flag.
+func keyFlags(sig *packet.Signature) (byte, bool) {
+	hashed, _, err := signatureSubpackets(sig)
+	if err != nil {
+		return 0, false
+	}
+	for _, sp := range hashed {
+		if sp.typ == subpacketKeyFlags && len(sp.contents) > 0 {
+			return sp.contents[0], true
+		}
+	}
+	return 0, false
+}
+
+// keyCapabilities returns the capabilities given by the key flags of a
+// self-signature or binding signature.
+func keyCapabilities(sig *packet.Signature) []string {
+	capabilities := []string{}
+	flags, ok := keyFlags(sig)
+	if !ok {
+		return capabilities
+	}
+	if flags&packet.KeyFlagCertify != 0 {
+		capabilities = append(capabilities, "certify")
+	}
+	if flags&packet.KeyFlagSign != 0 {
+		capabilities = append(capabilities, "sign")
+	}
+	if flags&(packet.KeyFlagEncryptCommunications|packet.KeyFlagEncryptStorage) != 0 {
+		capabilities = append(capabilities, "encrypt")
+	}
+	if flags&keyFlagAuthenticate != 0 {
+		capabilities = append(capabilities, "authenticate")
+	}
+	return capabilities
+}
+
+// signatureNotations returns the notations in the hashed subpackets of a
+// signature, see RFC 4880, section 5.2.3.16. The values of notations that are
+// not flagged as human-readable are base64 encoded. Malformed notations are
+// skipped, since the openpgp library does not validate them.
+func signatureNotations(sig *packet.Signature) []map[string]interface{} {
+	notations := []map[string]interface{}{}
+	hashed, _, err := signatureSubpackets(sig)
+	if err != nil {
+		return notations
+	}
+	for _, sp := range hashed {
+		if sp.typ != subpacketNotationData || len(sp.contents) < 8 {
+			continue
+		}
+		nameLength := int(binary.BigEndian.Uint16(sp.contents[4:6]))
+		valueLength := int(binary.BigEndian.Uint16(sp.contents[6:8]))
+		if len(sp.contents) != 8+nameLength+valueLength {
+			continue
+		}
+		humanReadable := sp.contents[0]&0x80 != 0
+		value := sp.contents[8+nameLength:]
+		notation := map[string]interface{}{
+			"name":           string(sp.contents[8 : 8+nameLength]),
+			"value":          string(value),
+			"human_readable": humanReadable,
+		}
+		if !humanReadable {
+			notation["value"] = base64.StdEncoding.EncodeToString(value)
+		}
+		notations = append(notations, notation)
+	}
+	return notations
+}
+
+// packetBody strips the header of a single serialized OpenPGP packet.
+func packetBody(p []byte) ([]byte, error) {
+	_, _, body, _, err := nextPacket(p)
+	return body, err
+}
+
+// nextPacket splits the first OpenPGP packet off p, and returns its tag, the
+// whole packet, its body and the remaining bytes. Partial body lengths are not
+// supported since they are not used for keys and signatures.
+func nextPacket(p []byte) (tag byte, packet, body, rest []byte, err error) {
+	if len(p) < 2 || p[0]&0x80 == 0 {
+		return 0, nil, nil, nil, fmt.Errorf("invalid packet header")
+	}
+	var headerLength, length int
+	if p[0]&0x40 == 0 {
+		// Old format packet
+		tag = (p[0] & 0x3f) >> 2
+		switch p[0] & 3 {
+		case 0:
+			headerLength, length = 2, int(p[1])
+		case 1:
+			if len(p) < 3 {
+				return 0, nil, nil, nil, fmt.Errorf("packet header truncated")
+			}
+			headerLength, length = 3, int(binary.BigEndian.Uint16(p[1:3]))
+		case 2:
+			if len(p) < 5 {
+				return 0, nil, nil, nil, fmt.Errorf("packet header truncated")
+			}
+			headerLength, length = 5, int(binary.BigEndian.Uint32(p[1:5]))
+		default:
+			headerLength, length = 1, len(p)-1
+		}
+	} else {
+		tag = p[0] & 0x3f
+		switch {
+		case p[1] < 192:
+			headerLength, length = 2, int(p[1])
+		case p[1] < 224:
+			if len(p) < 3 {
+				return 0, nil, nil, nil, fmt.Errorf("packet header truncated")
+			}
+			headerLength, length = 3, (int(p[1])-192)<<8+int(p[2])+192
+		case p[1] == 255:
+			if len(p) < 6 {
+				return 0, nil, nil, nil, fmt.Errorf("packet header truncated")
+			}
+			headerLength, length = 6, int(binary.BigEndian.Uint32(p[2:6]))
+		default:
+			return 0, nil, nil, nil, fmt.Errorf("partial body lengths are not supported")
+		}
+	}
+	if length < 0 || len(p)-headerLength < length {
+		return 0, nil, nil, nil, fmt.Errorf("packet truncated")
+	}
+	end := headerLength + length
+	return tag, p[:end], p[headerLength:end], p[end:], nil
+}
+
+// serializePacket writes a new format packet with the given tag and body.
+func serializePacket(w io.Writer, tag byte, body []byte) error {
+	header := []byte{newFormatPacketHeader | tag}
+	length := len(body)
+	switch {
+	case length < 192:
+		header = append(header, byte(length))
+	case length < 8384:
+		length -= 192
+		header = append(header, byte(length>>8)+192, byte(length))
+	default:
+		header = append(header, 255, byte(length>>24), byte(length>>16), byte(length>>8), byte(length))
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+// mpi encodes a big-endian integer as an OpenPGP multiprecision integer.
+func mpi(b []byte) []byte {
+	for len(b) > 0 && b[0] == 0 {
+		b = b[1:]
+	}
+	bitLength := 0
+	if len(b) > 0 {
+		bitLength = 8*(len(b)-1) + new(big.Int).SetBytes(b[:1]).BitLen()
+	}
+	return append([]byte{byte(bitLength >> 8), byte(bitLength)}, b...)
+}
+
+// signWithSubpackets creates a v4 signature of the data hashed in h with
+// arbitrary hashed and unhashed subpackets. This is needed for subpackets
+// that the openpgp library cannot produce, like the authentication key flag.
+func signWithSubpackets(h hash.Hash, sigType packet.SignatureType, signer *packet.PrivateKey, hashFunc crypto.Hash, hashed, unhashed []subpacket, rand io.Reader) (*packet.Signature, error) {
+	if signer.PublicKey.Version != 4 {
+		return nil, fmt.Errorf("only v4 keys are supported")
+	}
+	hashID, ok := s2k.HashToHashId(hashFunc)
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash function %v", hashFunc)
+	}
+
+	hashedArea := serializeSubpackets(hashed)
+	unhashedArea := serializeSubpackets(unhashed)
+	var body bytes.Buffer
+	body.Write([]byte{signaturePacketVersion, byte(sigType), byte(signer.PubKeyAlgo), hashID})
+	_ = binary.Write(&body, binary.BigEndian, uint16(len(hashedArea)))
+	body.Write(hashedArea)
+	hashedLength := body.Len()
+
+	// RFC 4880, section 5.2.4
+	h.Write(body.Bytes())
+	h.Write([]byte{signaturePacketVersion, 0xff})
+	_ = binary.Write(h, binary.BigEndian, uint32(hashedLength))
+	digest := h.Sum(nil)
+
+	_ = binary.Write(&body, binary.BigEndian, uint16(len(unhashedArea)))
+	body.Write(unhashedArea)
+	body.Write(digest[:2])
+
+	switch signer.PubKeyAlgo {
+	case packet.PubKeyAlgoRSA, packet.PubKeyAlgoRSASignOnly:
+		sig, err := signer.PrivateKey.(crypto.Signer).Sign(rand, digest, hashFunc)
+		if err != nil {
+			return nil, err
+		}
+		body.Write(mpi(sig))
+	case packet.PubKeyAlgoECDSA:
+		r, s, err := ecdsa.Sign(rand, signer.PrivateKey.(*ecdsa.PrivateKey), digest)
+		if err != nil {
+			return nil, err
+		}
+		body.Write(mpi(r.Bytes()))
+		body.Write(mpi(s.Bytes()))
+	case packet.PubKeyAlgoEdDSA:
+		sig, err := signer.PrivateKey.(crypto.Signer).Sign(rand, digest, crypto.Hash(0))
+		if err != nil {
+			return nil, err
+		}
+		body.Write(mpi(sig[:32]))
+		body.Write(mpi(sig[32:]))
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %v", signer.PubKeyAlgo)
+	}
+
+	var buf bytes.Buffer
+	if err := serializePacket(&buf, signaturePacketTag, body.Bytes()); err != nil {
+		return nil, err
+	}
+	p, err := packet.Read(&buf)
+	if err != nil {
+		return nil, err
+	}
+	sig, ok := p.(*packet.Signature)
+	if !ok {
+		return nil, fmt.Errorf("unable to parse generated signature")
+	}
+	return sig, nil
+}
+
+// creationTimeSubpacket returns a signature creation time subpacket.
+func creationTimeSubpacket(t time.Time) subpacket {
+	contents := make([]byte, 4)
+	binary.BigEndian.PutUint32(contents, uint32(t.Unix()))
+	return subpacket{subpacketCreationTime, contents}
+}
+
+// issuerSubpackets returns the issuer key ID and fingerprint subpackets of
+// the given signing key.
+func issuerSubpackets(pk *packet.PublicKey) (fingerprint, keyID subpacket) {
+	keyIDContents := make([]byte, 8)
+	binary.BigEndian.PutUint64(keyIDContents, pk.KeyId)
+	return subpacket{subpacketIssuerFingerprint, append([]byte{byte(pk.Version)}, pk.Fingerprint[:]...)},
+		subpacket{subpacketIssuer, keyIDContents}
+}
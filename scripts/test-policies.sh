@@ -116,8 +116,18 @@ without_root
 
 # Login as root and see if we can delete
 vault login root
-# Delete subkey
-vault delete $MOUNT_POINT/keys/$NAME/subkeys/$KEYID
+# Subkeys cannot be deleted, only revoked
+if vault delete $MOUNT_POINT/keys/$NAME/subkeys/$KEYID; then
+    echo "Deleted subkey!"
+    exit 8
+fi
+vault write -f $MOUNT_POINT/keys/$NAME/subkeys/$KEYID/revoke
+# Deleting the master key is refused until explicitly allowed
+if vault delete $MOUNT_POINT/keys/$NAME; then
+    echo "Deleted master key without deletion_allowed!"
+    exit 9
+fi
+vault write $MOUNT_POINT/keys/$NAME/config deletion_allowed=true
 # Delete master key
 vault delete $MOUNT_POINT/keys/$NAME
 